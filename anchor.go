@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// anchorCommands holds the subcommands of anchor.
+var anchorCommands = map[string]func(args []string){
+	"rename": anchorRenameCommand,
+	"inline": anchorInlineCommand,
+}
+
+// anchorCommand refactors the anchors of templates.
+func anchorCommand(args []string) {
+	if len(args) > 0 {
+		if run, ok := anchorCommands[args[0]]; ok {
+			run(args[1:])
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Usage of: %s anchor rename [options] <old> <new> [source or glob]...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s anchor inline [options] <name> [source or glob]...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Run %s anchor <command> -h for the options of a command.\n", os.Args[0])
+	if len(args) == 1 && (args[0] == "-h" || args[0] == "-help") {
+		return
+	}
+	os.Exit(exitUsage)
+}
+
+// anchorRenameCommand renames an anchor and its aliases in templates and
+// in the libraries they use.
+func anchorRenameCommand(args []string) {
+	flags := flag.NewFlagSet("anchor rename", flag.ExitOnError)
+	var write = flags.Bool("w", false, "Overwrite the sources that change instead of printing them. Comments are not kept and indentation is normalized")
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "anchor rename [options] <old> <new> [source or glob]...",
+		"renames the anchor in the sources and libraries it is used in, printing those that change, or with -w rewriting them",
+		"comments are not kept in the sources written",
+		"source defaults to stdin, which is written to stdout")
+
+	names := parseInterspersed(flags, args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if len(names) < 2 || names[0] == "" || names[1] == "" {
+		exitWithUsage(flags)
+	}
+	old, new := names[0], names[1]
+	if strings.ContainsAny(new, " \t\r\n,[]{}") {
+		failf(fmt.Errorf("invalid anchor name %q: anchor names can't hold whitespace or any of ,[]{}", new))
+	}
+
+	sources, err := readAnchorSources(names[2:], &load)
+
+	failf(err)
+
+	for _, s := range sources {
+		if _, ok := s.node.Anchors[new]; ok {
+			failf(fmt.Errorf("%s: anchor %s is already defined", s.displayPath(), new))
+		}
+	}
+
+	renamed := 0
+	for _, s := range sources {
+		s.changed = yaml.RenameAnchor(s.node, old, new)
+		renamed += s.changed
+	}
+	if renamed == 0 {
+		failf(fmt.Errorf("no anchor or alias named %s", old))
+	}
+
+	failf(writeAnchorSources(sources, *write, func(s *anchorSource) string {
+		return fmt.Sprintf("renamed %s to %s in %s", old, new, plural(s.changed, "place"))
+	}))
+}
+
+// anchorInlineCommand replaces the aliases to an anchor in templates with a
+// copy of the node it labels.
+func anchorInlineCommand(args []string) {
+	flags := flag.NewFlagSet("anchor inline", flag.ExitOnError)
+	var write = flags.Bool("w", false, "Overwrite the sources that change instead of printing them. Comments are not kept and indentation is normalized")
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "anchor inline [options] <name> [source or glob]...",
+		"replaces the aliases to the anchor in the sources with a copy of what it labels, printing those that change, or with -w rewriting them",
+		"comments are not kept in the sources written",
+		"source defaults to stdin, which is written to stdout. Libraries are left as they are")
+
+	names := parseInterspersed(flags, args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if len(names) < 1 || names[0] == "" {
+		exitWithUsage(flags)
+	}
+	name := names[0]
+
+	sources, err := readAnchorSources(names[1:], &load)
+
+	failf(err)
+
+	inlined := 0
+	for _, s := range sources {
+		if s.library {
+			continue
+		}
+		s.changed = yaml.InlineAnchor(s.node, name)
+		inlined += s.changed
+	}
+	if inlined == 0 {
+		failf(fmt.Errorf("no aliases named %s", name))
+	}
+
+	failf(writeAnchorSources(sources, *write, func(s *anchorSource) string {
+		return fmt.Sprintf("inlined %s to %s", plural(s.changed, "alias"), name)
+	}))
+}
+
+// plural returns n followed by word, in its plural form unless n is 1.
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	if strings.HasSuffix(word, "s") {
+		return fmt.Sprintf("%d %ses", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// An anchorSource is a template or library being refactored.
+type anchorSource struct {
+	path    string
+	library bool
+	node    *yaml.Node
+	// changed counts the nodes changed in the source.
+	changed int
+}
+
+func (s *anchorSource) displayPath() string {
+	if s.path == stdinPath {
+		return "<stdin>"
+	}
+	return s.path
+}
+
+// readAnchorSources parses the libraries of opts and the templates matching
+// patterns, or stdin if there are none, without inlining included files so
+// they can be written back. Libraries come first.
+func readAnchorSources(patterns []string, opts *loadOptions) ([]*anchorSource, error) {
+	if len(patterns) == 0 {
+		patterns = []string{stdinPath}
+	}
+	inputs, err := expandInputs(patterns, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []*anchorSource
+	var libraries []*yaml.Node
+
+	for _, path := range opts.libraries {
+		s, err := readAnchorSource(path, libraries, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.library = true
+		libraries = append(libraries, s.node)
+		sources = append(sources, s)
+	}
+
+	templates := make([]*anchorSource, len(inputs))
+	errs := parallel(len(inputs), runtime.NumCPU(), func(i int) error {
+		var err error
+		templates[i], err = readAnchorSource(inputs[i].path, libraries, opts)
+		return err
+	})
+	var failed errorList
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, failed
+	}
+
+	return append(sources, templates...), nil
+}
+
+func readAnchorSource(path string, libraries []*yaml.Node, opts *loadOptions) (*anchorSource, error) {
+	node, err := parseSource(path, opts.strict, libraries)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.DocumentNode, Anchors: make(map[string]*yaml.Node)}
+	}
+	node.SetLimits(opts.limits)
+	return &anchorSource{path: path, node: node}, nil
+}
+
+// writeAnchorSources prints the sources that changed, keeping their style,
+// or writes them back if write is set, and reports each one on stderr with
+// the message returned by describe. A source read from stdin is written to
+// stdout, changed or not. Nothing is written unless every source can be.
+func writeAnchorSources(sources []*anchorSource, write bool, describe func(s *anchorSource) string) error {
+	outputs := make([][]byte, len(sources))
+	for i, s := range sources {
+		if s.changed == 0 && s.path != stdinPath {
+			continue
+		}
+		out, err := yaml.MarshalSource(s.node, false)
+		if err != nil {
+			return pathError(s.path, err)
+		}
+		outputs[i] = out
+	}
+
+	for i, s := range sources {
+		switch {
+		case s.path == stdinPath || (s.changed > 0 && !write):
+			os.Stdout.Write(outputs[i])
+		case s.changed > 0:
+			if err := rewriteSource(s.path, outputs[i]); err != nil {
+				return err
+			}
+		}
+		if s.changed > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", s.displayPath(), describe(s))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An input is a source template to build and its path relative to the
+// directory its pattern was matched in, which is kept in the output
+// directory.
+type input struct {
+	path string
+	rel  string
+}
+
+// buildFlags are the flags of build, which are also those of cf-plus run
+// without a command.
+type buildFlags struct {
+	opts   buildOptions
+	config configOptions
+	outDir string
+	jobs   int
+}
+
+// register defines the flags that set f on flags.
+func (f *buildFlags) register(flags *flag.FlagSet) {
+	f.opts.register(flags)
+	f.config.register(flags)
+	flags.StringVar(&f.outDir, "o", "", "Directory to write the built templates to, mirroring their layout")
+	flags.IntVar(&f.jobs, "j", runtime.NumCPU(), "Number of templates to build in parallel")
+}
+
+// buildCommand builds every template matching its arguments, which are
+// template paths, directories or glob patterns, into an output directory
+// that mirrors their layout. Templates are built in parallel and failures
+// are reported together once every template has been attempted.
+func buildCommand(args []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	var f buildFlags
+	f.register(flags)
+
+	flags.Usage = usage(flags, "build [options] -o <dir> <source or glob>...",
+		"globs are matched by cf-plus and can use ** to match any number of directories",
+		"directories build every .yml and .yaml file below them, except hidden ones and those in the output directory",
+		"without sources, the inputs of the configuration file are built",
+		"exits with 1 if any template fails, or with --check if any isn't normalized")
+
+	patterns := parseInterspersed(flags, args)
+
+	cfg, err := f.config.apply(flags)
+
+	failf(err)
+
+	if len(patterns) == 0 && cfg != nil {
+		patterns = cfg.inputs()
+	}
+
+	if len(patterns) == 0 || !f.opts.valid() || f.jobs < 1 {
+		exitWithUsage(flags)
+	}
+
+	f.run(patterns)
+}
+
+// legacyCommand builds a single source to a single dest, which default to
+// stdin and stdout. With an output directory, several sources, --write or
+// --check it is the same as build.
+func legacyCommand(args []string) {
+	flags := flag.CommandLine
+	var f buildFlags
+	f.register(flags)
+
+	sourceUsage := usage(flags, "[options] [source] [dest]",
+		"source and dest default to stdin and stdout, which can also be given as -",
+		"this is build for a single template; exits with 1 if it fails")
+	flags.Usage = func() {
+		sourceUsage()
+		printCommands()
+	}
+
+	positional := parseInterspersed(flags, args)
+
+	cfg, err := f.config.apply(flags)
+
+	failf(err)
+
+	if !f.opts.valid() || f.jobs < 1 {
+		exitWithUsage(flags)
+	}
+
+	if f.opts.write || f.opts.check || len(positional) > 2 || (f.outDir != "" && len(positional) < 2) {
+		if len(positional) == 0 && cfg != nil {
+			positional = cfg.inputs()
+		}
+		if len(positional) == 0 {
+			exitWithUsage(flags)
+		}
+		f.run(positional)
+		return
+	}
+
+	path := stdinPath
+
+	if len(positional) > 0 {
+		path = positional[0]
+	}
+
+	outputPath := ""
+
+	if len(positional) > 1 && positional[1] != "-" {
+		outputPath = positional[1]
+	}
+
+	if f.opts.sourceMap && outputPath == "" {
+		failf(fmt.Errorf("--source-map requires a dest file"))
+	}
+
+	if f.opts.watch {
+		if path == stdinPath {
+			failf(fmt.Errorf("--watch requires a source file"))
+		}
+
+		newWatcher(&f.opts, 1, 1, func(b *builder, i int) ([]string, error) {
+			return b.buildFiles(path, outputPath)
+		}).run()
+	}
+
+	failf(newBuilder(&f.opts).build(path, outputPath))
+}
+
+// run builds, or with --write or --check formats, the templates matching
+// patterns and exits if any fail.
+func (f *buildFlags) run(patterns []string) {
+	inputs, err := expandInputs(patterns, f.outDir)
+
+	failf(err)
+
+	if len(inputs) == 0 {
+		failf(fmt.Errorf("no templates match %s", strings.Join(patterns, " ")))
+	}
+
+	if f.opts.write || f.opts.check {
+		formatInputs(inputs, &f.opts, f.jobs)
+		return
+	}
+
+	failf(checkOutputs(inputs))
+
+	if f.outDir == "" {
+		if len(inputs) > 1 {
+			failf(fmt.Errorf("building %d templates requires an output directory (-o)", len(inputs)))
+		}
+		if f.opts.sourceMap {
+			failf(fmt.Errorf("--source-map requires an output directory (-o)"))
+		}
+	}
+
+	build := func(b *builder, i int) ([]string, error) {
+		return buildInput(b, inputs[i], f.outDir)
+	}
+
+	if f.opts.watch {
+		for _, in := range inputs {
+			if in.path == stdinPath {
+				failf(fmt.Errorf("--watch requires source files"))
+			}
+		}
+
+		newWatcher(&f.opts, len(inputs), f.jobs, build).run()
+	}
+
+	b := newBuilder(&f.opts)
+	errs := parallel(len(inputs), f.jobs, func(i int) error {
+		_, err := build(b, i)
+		return err
+	})
+
+	exitOnFailures(errs)
+}
+
+// parallel calls fn for 0 to n-1 with up to workers calls running at a
+// time, returning the error of each call.
+func parallel(n int, workers int, fn func(i int) error) []error {
+	errs := make([]error, n)
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return errs
+}
+
+// exitOnFailures reports the errors of the templates that failed, if any,
+// and exits.
+func exitOnFailures(errs []error) {
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			printError(err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d templates failed\n", failed, len(errs))
+		os.Exit(exitFailure)
+	}
+}
+
+// buildInput builds in to its place in outDir, or prints it if no output
+// directory is given, returning the files read to build it.
+func buildInput(b *builder, in input, outDir string) ([]string, error) {
+	if outDir == "" {
+		return b.buildFiles(in.path, "")
+	}
+
+	outputPath := filepath.Join(outDir, in.rel)
+	if sameFile(in.path, outputPath) {
+		return []string{in.path}, fmt.Errorf("%s: building would overwrite the source; choose another output directory", in.path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return []string{in.path}, err
+	}
+
+	return b.buildFiles(in.path, outputPath)
+}
+
+// parseInterspersed parses args with flags, allowing flags to follow the
+// positional arguments, which are returned.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...)
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// expandInputs returns the templates named by patterns in order, without
+// duplicates. Walking directories skips outDir, if given, so that earlier
+// output isn't taken as input.
+func expandInputs(patterns []string, outDir string) ([]input, error) {
+	var inputs []input
+	seen := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		matches, err := expandPattern(pattern, outDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, in := range matches {
+			if !seen[in.path] {
+				seen[in.path] = true
+				inputs = append(inputs, in)
+			}
+		}
+	}
+
+	return inputs, nil
+}
+
+// checkOutputs reports an error if two inputs would be written to the same
+// place in the output directory.
+func checkOutputs(inputs []input) error {
+	outputs := make(map[string]string)
+	for _, in := range inputs {
+		if other, ok := outputs[in.rel]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", other, in.path, in.rel)
+		}
+		outputs[in.rel] = in.path
+	}
+	return nil
+}
+
+// templateExtensions are the extensions of the files built from a
+// directory given as an input.
+var templateExtensions = []string{".yml", ".yaml"}
+
+// expandPattern returns the templates matching pattern, which is a path, a
+// directory or a glob pattern where ** matches any number of directories.
+// Directories are walked as by glob.
+func expandPattern(pattern string, outDir string) ([]input, error) {
+	if pattern == stdinPath {
+		return []input{{path: stdinPath, rel: "stdin.yml"}}, nil
+	}
+
+	if !hasMeta(pattern) {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return []input{{path: filepath.Clean(pattern), rel: filepath.Base(pattern)}}, nil
+		}
+
+		var inputs []input
+		for _, ext := range templateExtensions {
+			matches, err := glob(filepath.Join(pattern, "**", "*"+ext), outDir)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, matches...)
+		}
+		sort.Slice(inputs, func(i, j int) bool { return inputs[i].path < inputs[j].path })
+		return inputs, nil
+	}
+
+	return glob(pattern, outDir)
+}
+
+// glob returns the files matching pattern, relative to the directory
+// before its first wildcard. Hidden files and directories below that
+// directory, such as .git or .cfplus.yml, and outDir if given, are
+// skipped.
+func glob(pattern string, outDir string) ([]input, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+
+	var i int
+	for i = 0; i < len(segments) && !hasMeta(segments[i]); i++ {
+	}
+	base := strings.Join(segments[:i], "/")
+	switch {
+	case base == "" && strings.HasPrefix(pattern, "/"):
+		base = "/"
+	case base == "":
+		base = "."
+	}
+	segments = segments[i:]
+
+	for _, s := range segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+	}
+
+	var inputs []input
+	root := filepath.FromSlash(base)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		hidden := strings.HasPrefix(info.Name(), ".")
+		if info.IsDir() {
+			if hidden || (outDir != "" && sameFile(p, outDir)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hidden {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			inputs = append(inputs, input{path: p, rel: rel})
+		}
+		return nil
+	})
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return inputs, err
+}
+
+// matchSegments reports whether the path segments in name match the
+// pattern segments, where a ** segment matches any number of segments.
+func matchSegments(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchSegments(pattern[1:], name[1:])
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
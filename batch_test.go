@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.yml", "a.yml", true},
+		{"*.yml", "a.yaml", false},
+		{"*.yml", "sub/a.yml", false},
+		{"**/*.yml", "a.yml", true},
+		{"**/*.yml", "sub/deep/a.yml", true},
+		{"sub/**/*.yml", "sub/a.yml", true},
+		{"sub/**/*.yml", "other/a.yml", false},
+		{"**", "sub/a.yml", true},
+		{"*/a.yml", "sub/deep/a.yml", false},
+		{"s?b/[ab].yml", "sub/b.yml", true},
+	}
+
+	for _, test := range tests {
+		got := matchSegments(strings.Split(test.pattern, "/"), strings.Split(test.name, "/"))
+		if got != test.want {
+			t.Errorf("matchSegments(%s, %s) = %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"sub/deep", ".git", "dist/dist"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, dir, map[string]string{
+		"a.yml":            "",
+		"b.json":           "",
+		".cfplus.yml":      "",
+		"sub/b.yml":        "",
+		"sub/deep/c.yaml":  "",
+		".git/x.yml":       "",
+		"dist/a.yml":       "",
+		"dist/.cfplus.yml": "",
+		"dist/dist/a.yml":  "",
+	})
+
+	tests := []struct {
+		name     string
+		patterns []string
+		outDir   string
+		want     []string
+	}{
+		{
+			name:     "directory",
+			patterns: []string{dir},
+			outDir:   filepath.Join(dir, "dist"),
+			want:     []string{"a.yml", "sub/b.yml", "sub/deep/c.yaml"},
+		},
+		{
+			name:     "directory without output",
+			patterns: []string{dir},
+			want:     []string{"a.yml", "dist/a.yml", "dist/dist/a.yml", "sub/b.yml", "sub/deep/c.yaml"},
+		},
+		{
+			name:     "glob",
+			patterns: []string{filepath.Join(dir, "**", "*.yml")},
+			outDir:   filepath.Join(dir, "dist"),
+			want:     []string{"a.yml", "sub/b.yml"},
+		},
+		{
+			name:     "glob below a directory",
+			patterns: []string{filepath.Join(dir, "sub", "**", "*")},
+			want:     []string{"b.yml", "deep/c.yaml"},
+		},
+		{
+			// files named outright are taken as they are
+			name:     "file",
+			patterns: []string{filepath.Join(dir, ".cfplus.yml"), filepath.Join(dir, "sub", "*.yml")},
+			want:     []string{".cfplus.yml", "b.yml"},
+		},
+		{
+			name:     "duplicates",
+			patterns: []string{filepath.Join(dir, "*.yml"), filepath.Join(dir, "a.yml")},
+			want:     []string{"a.yml"},
+		},
+		{
+			name:     "no matches",
+			patterns: []string{filepath.Join(dir, "missing", "*.yml")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inputs, err := expandInputs(test.patterns, test.outDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, in := range inputs {
+				got = append(got, filepath.ToSlash(in.rel))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := expandInputs([]string{filepath.Join(dir, "[")}, ""); err == nil {
+		t.Error("got no error for an invalid pattern")
+	}
+}
+
+func TestClaim(t *testing.T) {
+	b := newBuilder(&buildOptions{})
+
+	// the first goroutine to claim a child builds it
+	a, owned, err := b.claim("a.yml", "one.yml")
+	if err != nil || !owned {
+		t.Fatalf("got owned %v (%v), want the first claim to own a.yml", owned, err)
+	}
+
+	// a child being built is waited for and then shared
+	shared := make(chan *builtTemplate)
+	go func() {
+		child, owned, err := b.claim("a.yml", "two.yml")
+		if err != nil || owned {
+			t.Errorf("got owned %v (%v), want to wait for a.yml", owned, err)
+		}
+		shared <- child
+	}()
+	waitFor(t, b, "two.yml")
+
+	// two.yml waits for one.yml, so one.yml waiting for two.yml is a cycle
+	c, owned, err := b.claim("c.yml", "two.yml")
+	if !owned {
+		t.Fatalf("got owned %v (%v), want two.yml to own c.yml", owned, err)
+	}
+	if _, _, err := b.claim("c.yml", "one.yml"); err == nil || err.Error() != "c.yml is also being built from one.yml" {
+		t.Errorf("got %v, want a cycle between one.yml and two.yml", err)
+	}
+	close(c.done)
+
+	close(a.done)
+	if child := <-shared; child != a {
+		t.Errorf("got %p, want the build of a.yml", child)
+	}
+
+	// a finished child is shared without waiting
+	if child, owned, err := b.claim("a.yml", "three.yml"); child != a || owned || err != nil {
+		t.Errorf("got %p, owned %v (%v), want the build of a.yml", child, owned, err)
+	}
+}
+
+// waitFor waits until the goroutine building owner waits for a child.
+func waitFor(t *testing.T, b *builder, owner string) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		b.mu.Lock()
+		_, ok := b.waiting[owner]
+		b.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s never waited", owner)
+}
+
+func TestParallel(t *testing.T) {
+	tests := []struct {
+		n, workers int
+	}{
+		{10, 3},
+		{2, 8},
+		{1, 1},
+		{0, 4},
+	}
+
+	for _, test := range tests {
+		var mu sync.Mutex
+		running, most := 0, 0
+		calls := make([]int, test.n)
+
+		errs := parallel(test.n, test.workers, func(i int) error {
+			mu.Lock()
+			calls[i]++
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			if i%2 == 1 {
+				return errors.New("odd")
+			}
+			return nil
+		})
+
+		if len(errs) != test.n {
+			t.Fatalf("got %d errors, want %d", len(errs), test.n)
+		}
+		for i, err := range errs {
+			if calls[i] != 1 || (err != nil) != (i%2 == 1) {
+				t.Errorf("%d of %d: called %d times with error %v", i, test.n, calls[i], err)
+			}
+		}
+		if most > test.workers {
+			t.Errorf("%d of %d: %d calls ran at once, want at most %d", test.n, test.workers, most, test.workers)
+		}
+	}
+}
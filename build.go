@@ -0,0 +1,478 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// buildOptions controls how templates are processed.
+type buildOptions struct {
+	removeAliases  bool
+	keepStyle      bool
+	intrinsics     string
+	canonicalOrder bool
+	sortProperties bool
+	load           loadOptions
+	limits         string
+	nested         bool
+	validateNested bool
+	parameters     string
+	conditions     bool
+	resolve        bool
+	region         string
+	accountID      string
+	stackName      string
+	sourceMap      bool
+	write          bool
+	check          bool
+	watch          bool
+}
+
+// register defines the flags that set o on flags.
+func (o *buildOptions) register(flags *flag.FlagSet) {
+	flags.BoolVar(&o.removeAliases, "resolve-aliases", false, "Resolve all aliases to their target nodes")
+	flags.BoolVar(&o.keepStyle, "keep-style", false,
+		"Keep YAML style from source document. Default is to normalize (block style with quotes removed where they can be)")
+	o.registerFormat(flags)
+	o.load.register(flags)
+	flags.StringVar(&o.limits, "limits", "warn", "How to treat CloudFormation template limit violations: off, warn or error")
+	flags.BoolVar(&o.nested, "nested", false,
+		"Also process the local templates of nested stacks, writing them alongside the output and updating their TemplateURL")
+	flags.BoolVar(&o.validateNested, "validate-nested", false,
+		"Check parameters passed to, and outputs referenced from, nested stacks against their local templates")
+	flags.BoolVar(&o.conditions, "evaluate-conditions", false,
+		"Evaluate Conditions and Fn::If for the given parameters, removing resources, outputs and values that would not be deployed")
+	flags.BoolVar(&o.resolve, "resolve-intrinsics", false,
+		"Replace Fn::FindInMap, Fn::Join, Fn::Select and Fn::Sub with their value where all their inputs are known")
+	flags.StringVar(&o.region, "region", "", "Value of AWS::Region (and derived AWS::Partition and AWS::URLSuffix) when evaluating")
+	flags.StringVar(&o.accountID, "account-id", "", "Value of AWS::AccountId when evaluating")
+	flags.StringVar(&o.stackName, "stack-name", "", "Value of AWS::StackName when evaluating")
+	flags.BoolVar(&o.sourceMap, "source-map", false,
+		"Write a source map from lines of each output file to the source lines they came from, to <dest>.map.json")
+	flags.StringVar(&o.parameters, "parameters", "", "Parameters file (AWS CLI or CodePipeline format) to evaluate the template with")
+	flags.BoolVar(&o.write, "write", false,
+		"Overwrite each source with its normalized form instead of building it. Comments are not kept")
+	flags.BoolVar(&o.check, "check", false,
+		"List the sources whose normalized form differs from their contents and exit with 1 if there are any")
+	flags.BoolVar(&o.watch, "watch", false,
+		"Keep running, building templates again when they or any file they read change")
+}
+
+// registerFormat defines the flags that set the form of the output of o on
+// flags.
+func (o *buildOptions) registerFormat(flags *flag.FlagSet) {
+	flags.StringVar(&o.intrinsics, "intrinsics", "", "Convert intrinsic functions to their short (!Ref) or long (Ref:) form")
+	flags.BoolVar(&o.canonicalOrder, "canonical-order", false,
+		"Put top level sections and resource attributes in their conventional order (Type, Condition, DependsOn, Properties, ...)")
+	flags.BoolVar(&o.sortProperties, "sort-properties", false, "Put the properties of each resource in alphabetical order")
+}
+
+// valid reports whether the options given as flags have allowed values.
+func (o *buildOptions) valid() bool {
+	if o.limits != "off" && o.limits != "warn" && o.limits != "error" {
+		return false
+	}
+	if o.watch && (o.write || o.check) {
+		return false
+	}
+	return o.intrinsics == "" || o.intrinsics == "short" || o.intrinsics == "long"
+}
+
+// builder processes a template and, when nested stacks are enabled, the
+// local templates of its nested stacks. A builder can be shared by several
+// goroutines building templates in parallel.
+type builder struct {
+	opts *buildOptions
+	// built maps the source path of each child template to its build, so
+	// a template shared by several stacks is only processed and written
+	// once, even by stacks built in parallel.
+	built map[string]*builtTemplate
+	// waiting maps the top level template each goroutine is building to
+	// the child build it waits for, to find cycles between goroutines.
+	waiting map[string]*builtTemplate
+	mu      sync.Mutex
+}
+
+// builtTemplate is the build of a child template: the path it was written
+// to, the parameter values it was evaluated with, the files read to build
+// it and the error building it, available once done is closed. owner is
+// the top level template being built by the goroutine that builds it.
+type builtTemplate struct {
+	owner  string
+	done   chan struct{}
+	output string
+	values map[string]string
+	files  []string
+	err    error
+}
+
+func newBuilder(opts *buildOptions) *builder {
+	return &builder{opts: opts, built: make(map[string]*builtTemplate), waiting: make(map[string]*builtTemplate)}
+}
+
+// build processes the template at path and writes it to outputPath, or
+// prints it if no path is given. Nested templates are written alongside.
+func (b *builder) build(path string, outputPath string) error {
+	_, err := b.buildFiles(path, outputPath)
+	return err
+}
+
+// buildFiles is like build but also returns the files read to build the
+// template, including those read before an error, so that it can be built
+// again when any of them changes.
+func (b *builder) buildFiles(path string, outputPath string) ([]string, error) {
+	var files []string
+	var values map[string]string
+
+	if b.opts.conditions || b.opts.resolve {
+		if b.opts.parameters != "" {
+			files = append(files, b.opts.parameters)
+		}
+		var err error
+		if values, err = b.parameterValues(); err != nil {
+			return append(files, path), pathError(path, err)
+		}
+	}
+
+	err := b.buildTemplate(path, outputPath, nil, values, &files)
+	return files, err
+}
+
+// buildTemplate processes the template at path into outputPath, evaluating
+// it with the parameter values in values if evaluation is enabled.
+func (b *builder) buildTemplate(path string, outputPath string, parents []string, values map[string]string, files *[]string) error {
+	outDir := filepath.Dir(outputPath)
+	node, included, err := loadTemplateFiles(path, &b.opts.load)
+	*files = append(append(*files, path), included...)
+	if err != nil {
+		return err
+	}
+
+	if b.opts.validateNested {
+		if err := validateNested(node, path, b.opts.load.strict); err != nil {
+			return err
+		}
+	}
+
+	if b.opts.nested {
+		if err := b.buildNested(node, path, outDir, append(parents, path), values, files); err != nil {
+			return err
+		}
+	}
+
+	if b.opts.conditions || b.opts.resolve {
+		if node, err = b.evaluate(node, values); err != nil {
+			return pathError(path, err)
+		}
+	}
+
+	normalize(node, b.opts)
+
+	var out []byte
+	var sourceMap []yaml.SourcePosition
+
+	switch {
+	case b.opts.sourceMap:
+		out, sourceMap, err = yaml.MarshalWithSourceMap(node, b.opts.removeAliases, !b.opts.keepStyle)
+	case outputPath == "" && b.opts.limits == "off":
+		// with no limits to check, stream straight to stdout
+		err = yaml.MarshalTreeToWriter(os.Stdout, node, b.opts.removeAliases, !b.opts.keepStyle)
+		if err != nil {
+			return pathError(path, err)
+		}
+		return nil
+	default:
+		out, err = yaml.MarshalFromTree(node, b.opts.removeAliases, !b.opts.keepStyle)
+	}
+
+	if err != nil {
+		return pathError(path, err)
+	}
+
+	// the limits are checked before anything is written, so that a
+	// template rejected for exceeding them is never output
+	if err := checkLimits(out, b.opts.limits, path); err != nil {
+		return err
+	}
+
+	if err := writeOutput(out, outputPath); err != nil {
+		return err
+	}
+
+	if b.opts.sourceMap {
+		return writeSourceMap(sourceMap, outputPath)
+	}
+
+	return nil
+}
+
+// buildNested processes the local child template of each nested stack in
+// node, writes it to outDir and points the stack's TemplateURL at it.
+// Each child is evaluated with the parameters its stack passes it, given
+// the values of the parameters of node. parents holds the chain of
+// templates being processed, to detect cycles. The files read to build
+// the children are added to files.
+func (b *builder) buildNested(node *yaml.Node, path string, outDir string, parents []string, values map[string]string, files *[]string) error {
+	var passed map[string]map[string]string
+	if b.opts.conditions || b.opts.resolve {
+		var err error
+		if passed, err = cfn.NestedStackParameters(node, values); err != nil {
+			return pathError(path, err)
+		}
+	}
+
+	for _, stack := range cfn.NestedStacks(node) {
+		childPath := stack.TemplateURL.Value
+		if !filepath.IsAbs(childPath) {
+			childPath = filepath.Join(filepath.Dir(path), childPath)
+		}
+		childPath = filepath.Clean(childPath)
+
+		for _, parent := range parents {
+			if sameFile(parent, childPath) {
+				return fmt.Errorf("%s: nested stack %s creates a cycle: %s -> %s",
+					path, stack.Name, strings.Join(parents, " -> "), childPath)
+			}
+		}
+
+		child, owned, err := b.claim(childPath, parents[0])
+		if err != nil {
+			return fmt.Errorf("%s: nested stack %s creates a cycle: %v", path, stack.Name, err)
+		}
+
+		if owned {
+			child.output = filepath.Join(outDir, nestedOutputName(stack.TemplateURL.Value))
+			child.values = passed[stack.Name]
+			child.err = b.buildChild(childPath, child, parents, stack.Name, path)
+			close(child.done)
+		}
+
+		*files = append(*files, child.files...)
+		if child.err != nil {
+			return child.err
+		}
+
+		// a shared child is written once, so it can only be evaluated
+		// for one set of parameters
+		if !reflect.DeepEqual(child.values, passed[stack.Name]) {
+			return fmt.Errorf("%s: nested stack %s passes other parameters to %s than another stack using it, so it can't be evaluated for both",
+				path, stack.Name, childPath)
+		}
+
+		url, err := filepath.Rel(outDir, child.output)
+		if err != nil {
+			return err
+		}
+		stack.TemplateURL.Replace(yaml.NewScalar("./"+filepath.ToSlash(url), ""))
+	}
+	return nil
+}
+
+// claim returns the build of the child template at childPath for the
+// goroutine building the top level template owner. If no goroutine has
+// started building the child, owned is true and the caller must build it
+// and close its done channel; otherwise claim waits for the build to
+// finish. Waiting on a goroutine that is itself waiting on owner, directly
+// or through others, would never end, and fails instead: the templates
+// being built refer to each other.
+func (b *builder) claim(childPath string, owner string) (child *builtTemplate, owned bool, err error) {
+	b.mu.Lock()
+	child, ok := b.built[childPath]
+	if !ok {
+		child = &builtTemplate{owner: owner, done: make(chan struct{})}
+		b.built[childPath] = child
+		b.mu.Unlock()
+		return child, true, nil
+	}
+
+	select {
+	case <-child.done:
+		b.mu.Unlock()
+		return child, false, nil
+	default:
+	}
+
+	for build := child; build != nil; build = b.waiting[build.owner] {
+		if build.owner == owner {
+			b.mu.Unlock()
+			return nil, false, fmt.Errorf("%s is also being built from %s", childPath, owner)
+		}
+	}
+	b.waiting[owner] = child
+	b.mu.Unlock()
+
+	<-child.done
+
+	b.mu.Lock()
+	delete(b.waiting, owner)
+	b.mu.Unlock()
+	return child, false, nil
+}
+
+// buildChild processes the child template at childPath, the template of
+// nested stack name in the template at path, into child.output.
+func (b *builder) buildChild(childPath string, child *builtTemplate, parents []string, name string, path string) error {
+	if sameFile(child.output, childPath) {
+		return fmt.Errorf("%s: processing nested stack %s would overwrite its source %s; choose another output directory",
+			path, name, childPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(child.output), 0755); err != nil {
+		return err
+	}
+	return b.buildTemplate(childPath, child.output, parents, child.values, &child.files)
+}
+
+// parameterValues returns the values the templates being built are
+// evaluated with: those in the parameters file and the pseudo parameters
+// in the build options.
+func (b *builder) parameterValues() (map[string]string, error) {
+	values := cfn.PseudoParameters(b.opts.region, b.opts.accountID, b.opts.stackName)
+
+	if b.opts.parameters != "" {
+		data, err := ioutil.ReadFile(b.opts.parameters)
+		if err != nil {
+			return nil, err
+		}
+
+		parameters, err := cfn.ReadParameters(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", b.opts.parameters, err)
+		}
+
+		for k, v := range parameters {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+// evaluate evaluates the parts of node known before deployment, given the
+// values of its parameters and pseudo parameters.
+func (b *builder) evaluate(node *yaml.Node, values map[string]string) (*yaml.Node, error) {
+	var err error
+
+	if b.opts.conditions {
+		if node, err = cfn.EvaluateConditions(node, values); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.opts.resolve {
+		if node, err = cfn.ResolveIntrinsics(node, values); err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
+
+// normalize applies the options of opts that change the form, but not the
+// meaning, of the template node.
+func normalize(node *yaml.Node, opts *buildOptions) {
+	switch opts.intrinsics {
+	case "short":
+		cfn.ToShortForm(node)
+	case "long":
+		cfn.ToLongForm(node)
+	}
+	if opts.canonicalOrder {
+		cfn.CanonicalOrder(node)
+	}
+	if opts.sortProperties {
+		cfn.SortProperties(node)
+	}
+}
+
+// errorList is a list of errors reported together, one per line.
+type errorList []error
+
+func (l errorList) Error() string {
+	lines := make([]string, len(l))
+	for i, err := range l {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateNested checks the parameters passed to the nested stacks of the
+// template at path, returning every problem found. Children are parsed in
+// strict mode if strict is set.
+func validateNested(node *yaml.Node, path string, strict bool) error {
+	var errs errorList
+
+	for _, err := range cfn.ValidateNestedStacks(node, filepath.Dir(path), strict) {
+		errs = append(errs, pathError(path, err))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// nestedOutputName returns the path, relative to the parent's output
+// directory, that a child template referred to by url is written to. The
+// child keeps its relative location unless it lies outside the parent's
+// directory, in which case only its name is kept.
+func nestedOutputName(url string) string {
+	name := filepath.Clean(url)
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+		return filepath.Base(name)
+	}
+	return name
+}
+
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
+
+// writeOutput writes out to outputPath, or to stdout if no path is given.
+// Status messages go to stderr so they don't mix with piped output.
+func writeOutput(out []byte, outputPath string) error {
+	if len(outputPath) > 0 {
+		fmt.Fprintln(os.Stderr, "writing file to "+outputPath)
+		return ioutil.WriteFile(outputPath, out, 0644)
+	}
+	_, err := os.Stdout.Write(out)
+	return err
+}
+
+// checkLimits reports CloudFormation limit violations in the template
+// emitted from path according to mode, which is one of off, warn or error.
+func checkLimits(out []byte, mode string, path string) error {
+	if mode == "off" {
+		return nil
+	}
+
+	violations, err := cfn.CheckLimits(out, cfn.DefaultLimits)
+	if err != nil {
+		return pathError(path, err)
+	}
+
+	for _, v := range violations {
+		fmt.Fprintln(os.Stderr, pathError(path, fmt.Errorf("%s: %s", mode, v)))
+	}
+
+	if mode == "error" && len(violations) > 0 {
+		return pathError(path, fmt.Errorf("template exceeds %d CloudFormation limits", len(violations)))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// writeFiles writes each file in files, keyed by path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFile returns the contents of the file at path, failing the test if
+// it can't be read.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBuildEvaluatesNestedStacks(t *testing.T) {
+	const child = `Parameters:
+  Env: {Type: String, Default: dev}
+Conditions:
+  IsProd: !Equals [!Ref Env, prod]
+Resources:
+  Queue: {Type: Q, Condition: IsProd}
+  Topic: {Type: T}
+`
+
+	tests := []struct {
+		name   string
+		parent string
+		// want holds the output of each child template.
+		want map[string]string
+		err  string
+	}{
+		{
+			// the child takes its own default rather than the parent's value
+			name:   "default",
+			parent: "Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: child.yml}}\n",
+			want:   map[string]string{"child.yml": "Parameters:\n  Env:\n    Type: String\n    Default: dev\nResources:\n  Topic:\n    Type: T\n"},
+		},
+		{
+			name:   "passed",
+			parent: "Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: child.yml, Parameters: {Env: !Ref Env}}}\n",
+			want: map[string]string{"child.yml": "Parameters:\n  Env:\n    Type: String\n    Default: dev\n" +
+				"Resources:\n  Queue:\n    Type: Q\n  Topic:\n    Type: T\n"},
+		},
+		{
+			name:   "unknown",
+			parent: "Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: child.yml, Parameters: {Env: !GetAtt R.Env}}}\n",
+			want: map[string]string{"child.yml": "Parameters:\n  Env:\n    Type: String\n    Default: dev\n" +
+				"Conditions:\n  IsProd: !Equals\n  - !Ref 'Env'\n  - prod\n" +
+				"Resources:\n  Queue:\n    Type: Q\n    Condition: IsProd\n  Topic:\n    Type: T\n"},
+		},
+		{
+			name: "shared with other values",
+			parent: "Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: child.yml}}\n" +
+				"  P: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: child.yml, Parameters: {Env: !Ref Env}}}\n",
+			err: "passes other parameters to",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			out := filepath.Join(dir, "out")
+			writeFiles(t, dir, map[string]string{
+				"parent.yml":  "Parameters:\n  Env: {Type: String}\n" + test.parent,
+				"child.yml":   child,
+				"params.json": `{"Parameters": {"Env": "prod"}}`,
+			})
+
+			opts := buildOptions{nested: true, conditions: true, parameters: filepath.Join(dir, "params.json"), limits: "off"}
+			err := newBuilder(&opts).build(filepath.Join(dir, "parent.yml"), filepath.Join(out, "parent.yml"))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range test.want {
+				if got := readFile(t, filepath.Join(out, name)); got != want {
+					t.Errorf("%s: got %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateNested(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "parent.yml")
+	writeFiles(t, dir, map[string]string{
+		"child.yml":  "Parameters:\n  Env: {Type: String}\n",
+		"parent.yml": "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: child.yml\n",
+	})
+
+	node, err := loadTemplate(path, &loadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// errors keep their position and code, and take the file once
+	errs, ok := validateNested(node, path, false).(errorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got %v, want one error", errs)
+	}
+	want := path + ":3:5: nested stack S does not pass parameter Env required by child.yml [nested-parameter]"
+	if e, ok := errs[0].(*yaml.Error); !ok || e.Error() != want {
+		t.Errorf("got %v, want %s", errs[0], want)
+	}
+}
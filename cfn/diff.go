@@ -0,0 +1,138 @@
+package cfn
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// Kinds of Change.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// A Change is a single difference between two templates.
+type Change struct {
+	Kind string `json:"change"`
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return "+ " + c.Path
+	case Removed:
+		return "- " + c.Path
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// diffSections are the template sections compared by Diff.
+var diffSections = []string{"Parameters", "Resources", "Outputs"}
+
+// Diff returns the differences between the Parameters, Resources and
+// Outputs of templates a and b, with the path of each. Aliases and merge
+// keys are resolved and intrinsic functions are compared in their long
+// form, so differences in key order, quoting style and function form are
+// ignored. Entries added to or removed from a section are reported as a
+// whole; entries in both are compared down to the values that differ.
+func Diff(a, b *yaml.Node) ([]Change, error) {
+	ea, err := canonical(a)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := canonical(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, name := range diffSections {
+		// a missing section is compared as an empty one, so that its
+		// entries are reported individually
+		sa, sb := section(ea, name), section(eb, name)
+		if sa == nil {
+			sa = yaml.NewMapping()
+		}
+		if sb == nil {
+			sb = yaml.NewMapping()
+		}
+		changes = diffNodes(changes, name, sa, sb)
+	}
+	return changes, nil
+}
+
+// canonical returns an expanded copy of doc with intrinsic functions in
+// their long form.
+func canonical(doc *yaml.Node) (*yaml.Node, error) {
+	expanded, err := yaml.Expand(doc)
+	if err != nil {
+		return nil, err
+	}
+	ToLongForm(expanded)
+	return expanded, nil
+}
+
+func diffNodes(changes []Change, path string, a, b *yaml.Node) []Change {
+	switch {
+	case a == nil && b == nil:
+		return changes
+	case a == nil:
+		return append(changes, Change{Kind: Added, Path: path, New: summary(b)})
+	case b == nil:
+		return append(changes, Change{Kind: Removed, Path: path, Old: summary(a)})
+	case a.Kind != b.Kind || a.Tag != b.Tag:
+		return append(changes, Change{Kind: Changed, Path: path, Old: summary(a), New: summary(b)})
+	}
+
+	switch a.Kind {
+	case yaml.MappingNode:
+		for _, key := range keys(a) {
+			changes = diffNodes(changes, path+"."+key, lookup(a, key), lookup(b, key))
+		}
+		for _, key := range keys(b) {
+			if lookup(a, key) == nil {
+				changes = diffNodes(changes, path+"."+key, nil, lookup(b, key))
+			}
+		}
+	case yaml.SequenceNode:
+		for i := 0; i < len(a.Children) || i < len(b.Children); i++ {
+			var ca, cb *yaml.Node
+			if i < len(a.Children) {
+				ca = a.Children[i]
+			}
+			if i < len(b.Children) {
+				cb = b.Children[i]
+			}
+			changes = diffNodes(changes, path+"["+strconv.Itoa(i)+"]", ca, cb)
+		}
+	default:
+		if a.Value != b.Value {
+			changes = append(changes, Change{Kind: Changed, Path: path, Old: summary(a), New: summary(b)})
+		}
+	}
+	return changes
+}
+
+// summary describes n in a change: the quoted value of a scalar, or the
+// kind of a collection.
+func summary(n *yaml.Node) string {
+	prefix := ""
+	if n.Tag != "" {
+		prefix = n.Tag + " "
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		return prefix + "{...}"
+	case yaml.SequenceNode:
+		return prefix + "[...]"
+	default:
+		return prefix + strconv.Quote(n.Value)
+	}
+}
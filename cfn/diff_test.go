@@ -0,0 +1,76 @@
+package cfn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []string
+	}{
+		{
+			name: "key order and function form",
+			a:    "Resources:\n  A: {Type: T, Properties: {X: 1, Y: !Ref P}}\n",
+			b:    "Resources:\n  A:\n    Properties:\n      Y: {Ref: P}\n      X: 1\n    Type: T\n",
+		},
+		{
+			name: "aliases",
+			a:    "x: &x {Type: T}\nResources:\n  A: *x\n",
+			b:    "Resources:\n  A: {Type: T}\n",
+		},
+		{
+			name: "quoting",
+			a:    "Resources:\n  A: {Type: T, Properties: {X: 1}}\n",
+			b:    "Resources:\n  A: {Type: T, Properties: {X: '1'}}\n",
+		},
+		{
+			name: "added, removed and changed",
+			a:    "Resources:\n  A: {Type: T}\n  B: {Type: T}\n",
+			b:    "Resources:\n  A: {Type: U}\n  C: {Type: T}\n",
+			want: []string{`~ Resources.A.Type: "T" -> "U"`, "- Resources.B", "+ Resources.C"},
+		},
+		{
+			name: "lists",
+			a:    "Resources:\n  A: {Type: T, Properties: {L: [1, 2]}}\n",
+			b:    "Resources:\n  A: {Type: T, Properties: {L: [1, 3, 4]}}\n",
+			want: []string{`~ Resources.A.Properties.L[1]: "2" -> "3"`, "+ Resources.A.Properties.L[2]"},
+		},
+		{
+			name: "kind",
+			a:    "Resources:\n  A: {Type: T, Properties: {X: {a: 1}}}\n",
+			b:    "Resources:\n  A: {Type: T, Properties: {X: [1]}}\n",
+			want: []string{"~ Resources.A.Properties.X: {...} -> [...]"},
+		},
+		{
+			name: "function",
+			a:    "Outputs:\n  O: {Value: !Ref A}\n",
+			b:    "Outputs:\n  O: {Value: !Ref B}\n",
+			want: []string{`~ Outputs.O.Value.Ref: "A" -> "B"`},
+		},
+		{
+			name: "missing sections",
+			a:    "Outputs:\n  O: {Value: 1}\n",
+			b:    "Parameters:\n  P: {Type: String}\n",
+			want: []string{"+ Parameters.P", "- Outputs.O"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := Diff(parse(t, test.a), parse(t, test.b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,628 @@
+package cfn
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// evaluator evaluates the parts of a template that only depend on values
+// known before deployment.
+type evaluator struct {
+	// values holds parameter values keyed by name.
+	values     map[string]string
+	mappings   *yaml.Node
+	conditions *yaml.Node
+	// results and unknown hold the conditions evaluated so far, those in
+	// unknown depending on values that aren't known.
+	results    map[string]bool
+	unknown    map[string]bool
+	evaluating []string
+}
+
+// newEvaluator returns an evaluator for doc with the parameter values in
+// values, and the defaults of the parameters without one if defaults is
+// set. Parameters whose value is UnknownValue are left unknown.
+func newEvaluator(doc *yaml.Node, values map[string]string, defaults bool) *evaluator {
+	e := &evaluator{
+		values:     make(map[string]string),
+		mappings:   section(doc, "Mappings"),
+		conditions: section(doc, "Conditions"),
+		results:    make(map[string]bool),
+		unknown:    make(map[string]bool),
+	}
+
+	if defaults {
+		pairs(section(doc, "Parameters"), func(key, value *yaml.Node) {
+			if d := lookup(value, "Default"); d != nil && d.Kind == yaml.ScalarNode {
+				e.values[key.Value] = d.Value
+			}
+		})
+	}
+	for k, v := range values {
+		e.values[k] = v
+		if v == UnknownValue {
+			delete(e.values, k)
+		}
+	}
+	return e
+}
+
+// EvaluateConditions returns the effective template for a set of parameter
+// values. Conditions are evaluated where resources, outputs and Fn::If use
+// them; resources and outputs whose condition is false are removed, along
+// with references to removed resources in DependsOn, and each Fn::If is
+// replaced by the branch it selects. Values that select AWS::NoValue are
+// removed. Conditions that depend on values that aren't known, such as
+// pseudo parameters that weren't given, are left in place along with the
+// Conditions entries they need. Aliases and merge keys are resolved in the
+// returned tree; doc is left untouched. Parameters without a value in
+// values take their default, unless their value is UnknownValue.
+func EvaluateConditions(doc *yaml.Node, values map[string]string) (*yaml.Node, error) {
+	expanded, err := yaml.Expand(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	e := newEvaluator(expanded, values, true)
+
+	top := root(expanded)
+	if top == nil {
+		return expanded, nil
+	}
+
+	removed := make(map[string]bool)
+	for _, name := range []string{"Resources", "Outputs"} {
+		if err := e.removeFalse(lookup(top, name), removed); err != nil {
+			return nil, err
+		}
+	}
+
+	pairs(lookup(top, "Resources"), func(key, resource *yaml.Node) {
+		removeDependencies(resource, removed)
+	})
+
+	if outputs := lookup(top, "Outputs"); outputs != nil && len(outputs.Children) == 0 {
+		removeKey(top, "Outputs")
+	}
+
+	if _, err := e.prune(top); err != nil {
+		return nil, err
+	}
+
+	e.removeUnused(top)
+
+	return expanded, nil
+}
+
+// removeUnused removes the conditions that nothing in the template refers
+// to any more, and the Conditions section if none are left.
+func (e *evaluator) removeUnused(top *yaml.Node) {
+	used := make(map[string]bool)
+	var use func(name string)
+	use = func(name string) {
+		if used[name] {
+			return
+		}
+		used[name] = true
+		walk(lookup(e.conditions, name), func(n *yaml.Node) {
+			if name, args, ok := function(n); ok && name == "Condition" {
+				use(args.Value)
+			}
+		})
+	}
+
+	for _, section := range []string{"Resources", "Outputs"} {
+		pairs(lookup(top, section), func(key, value *yaml.Node) {
+			if c := lookup(value, "Condition"); c != nil && c.Kind == yaml.ScalarNode {
+				use(c.Value)
+			}
+		})
+	}
+	pairs(top, func(key, value *yaml.Node) {
+		if key.Value == "Conditions" {
+			return
+		}
+		walk(value, func(n *yaml.Node) {
+			if name, args, ok := function(n); ok && name == "Fn::If" && args.Kind == yaml.SequenceNode && len(args.Children) > 0 {
+				use(resolve(args.Children[0]).Value)
+			}
+		})
+	})
+
+	conditions := lookup(top, "Conditions")
+	if conditions == nil || conditions.Kind != yaml.MappingNode {
+		removeKey(top, "Conditions")
+		return
+	}
+	var children []*yaml.Node
+	for i := 0; i+1 < len(conditions.Children); i += 2 {
+		if used[conditions.Children[i].Value] {
+			children = append(children, conditions.Children[i], conditions.Children[i+1])
+		}
+	}
+	conditions.Children = children
+	if len(children) == 0 {
+		removeKey(top, "Conditions")
+	}
+}
+
+// removeFalse removes the entries of a Resources or Outputs section whose
+// condition is false, recording removed names, and drops the Condition
+// attribute of the entries whose condition is true.
+func (e *evaluator) removeFalse(m *yaml.Node, removed map[string]bool) error {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var children []*yaml.Node
+	for i := 0; i+1 < len(m.Children); i += 2 {
+		key, value := m.Children[i], m.Children[i+1]
+
+		if c := lookup(value, "Condition"); c != nil && c.Kind == yaml.ScalarNode {
+			result, known, err := e.condition(c.Value, c)
+			if err != nil {
+				return err
+			}
+			if known && !result {
+				removed[key.Value] = true
+				continue
+			}
+			if known {
+				removeKey(value, "Condition")
+			}
+		}
+
+		children = append(children, key, value)
+	}
+	m.Children = children
+	return nil
+}
+
+// removeDependencies removes removed resources from the DependsOn
+// attribute of resource.
+func removeDependencies(resource *yaml.Node, removed map[string]bool) {
+	dependsOn := lookup(resource, "DependsOn")
+	if dependsOn == nil {
+		return
+	}
+
+	switch dependsOn.Kind {
+	case yaml.ScalarNode:
+		if removed[dependsOn.Value] {
+			removeKey(resource, "DependsOn")
+		}
+	case yaml.SequenceNode:
+		var children []*yaml.Node
+		for _, c := range dependsOn.Children {
+			if !removed[c.Value] {
+				children = append(children, c)
+			}
+		}
+		dependsOn.Children = children
+		if len(children) == 0 {
+			removeKey(resource, "DependsOn")
+		}
+	}
+}
+
+// removeKey removes key and its value from the mapping m.
+func removeKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Children); i += 2 {
+		if m.Children[i].Kind == yaml.ScalarNode && m.Children[i].Value == key {
+			m.Children = append(m.Children[:i:i], m.Children[i+2:]...)
+			return
+		}
+	}
+}
+
+// function returns the name and argument of an intrinsic function in
+// either its short or long form, e.g. Fn::Equals and its list of values.
+func function(n *yaml.Node) (name string, args *yaml.Node, ok bool) {
+	if n == nil {
+		return "", nil, false
+	}
+	if key, ok := intrinsics[n.Tag]; ok {
+		value := *n
+		value.Tag = ""
+		return key, &value, true
+	}
+	if n.Kind == yaml.MappingNode && len(n.Children) == 2 {
+		key := resolve(n.Children[0])
+		if _, ok := shortTags[key.Value]; ok && key.Kind == yaml.ScalarNode {
+			return key.Value, resolve(n.Children[1]), true
+		}
+	}
+	return "", nil, false
+}
+
+// condition returns the value of the named condition, evaluating it on
+// first use, and whether it is known. at is the node referring to the
+// condition, for errors.
+func (e *evaluator) condition(name string, at *yaml.Node) (result bool, known bool, err error) {
+	if result, ok := e.results[name]; ok {
+		return result, true, nil
+	}
+	if e.unknown[name] {
+		return false, false, nil
+	}
+
+	for i, n := range e.evaluating {
+		if n == name {
+			return false, false, nodeErrorf(at, "condition-cycle", "condition %s refers to itself: %s -> %s",
+				name, strings.Join(e.evaluating[i:], " -> "), name)
+		}
+	}
+
+	definition := lookup(e.conditions, name)
+	if definition == nil {
+		return false, false, nodeErrorf(at, "unknown-condition", "unknown condition %s", name)
+	}
+
+	e.evaluating = append(e.evaluating, name)
+	result, known, err = e.evalCondition(definition)
+	e.evaluating = e.evaluating[:len(e.evaluating)-1]
+	if err != nil {
+		return false, false, err
+	}
+
+	if known {
+		e.results[name] = result
+	} else {
+		e.unknown[name] = true
+	}
+	return result, known, nil
+}
+
+// evalCondition evaluates a condition function, returning whether its
+// result is known. An Fn::And with a false operand, or an Fn::Or with a
+// true one, is known even if its other operands aren't.
+func (e *evaluator) evalCondition(n *yaml.Node) (result bool, known bool, err error) {
+	name, args, ok := function(n)
+	if !ok {
+		return false, false, nodeErrorf(n, "invalid-condition", "expected a condition function")
+	}
+
+	switch name {
+	case "Condition":
+		return e.condition(args.Value, n)
+	case "Fn::Equals":
+		if args.Kind != yaml.SequenceNode || len(args.Children) != 2 {
+			return false, false, nodeErrorf(n, "invalid-condition", "Fn::Equals expects a list of two values")
+		}
+		a, aKnown := e.literal(args.Children[0])
+		b, bKnown := e.literal(args.Children[1])
+		return a == b, aKnown && bKnown, nil
+	case "Fn::Not":
+		if args.Kind != yaml.SequenceNode || len(args.Children) != 1 {
+			return false, false, nodeErrorf(n, "invalid-condition", "Fn::Not expects a list of one condition")
+		}
+		result, known, err := e.evalCondition(resolve(args.Children[0]))
+		return !result, known, err
+	case "Fn::And", "Fn::Or":
+		if args.Kind != yaml.SequenceNode || len(args.Children) == 0 {
+			return false, false, nodeErrorf(n, "invalid-condition", "%s expects a list of conditions", name)
+		}
+		// the result of Fn::And is decided by a false operand, and that of
+		// Fn::Or by a true one
+		decisive := name == "Fn::Or"
+		known := true
+		for _, c := range args.Children {
+			r, k, err := e.evalCondition(resolve(c))
+			if err != nil {
+				return false, false, err
+			}
+			if k && r == decisive {
+				return decisive, true, nil
+			}
+			known = known && k
+		}
+		return !decisive, known, nil
+	default:
+		return false, false, nodeErrorf(n, "invalid-condition", "%s is not a condition function", name)
+	}
+}
+
+// literal returns the string value of n if it is known before deployment:
+// a literal scalar, a reference to a parameter or pseudo parameter with a
+// known value, or an Fn::FindInMap, Fn::Join, Fn::Select or Fn::Sub whose
+// inputs are all known.
+func (e *evaluator) literal(n *yaml.Node) (string, bool) {
+	n = resolve(n)
+	if n.Kind == yaml.ScalarNode && n.Tag == "" {
+		return n.Value, true
+	}
+
+	name, args, ok := function(n)
+	if !ok {
+		return "", false
+	}
+
+	switch name {
+	case "Ref":
+		v, ok := e.values[args.Value]
+		return v, ok && args.Kind == yaml.ScalarNode
+	case "Fn::FindInMap":
+		if args.Kind != yaml.SequenceNode || len(args.Children) != 3 {
+			return "", false
+		}
+		var path [3]string
+		for i, c := range args.Children {
+			if path[i], ok = e.literal(c); !ok {
+				return "", false
+			}
+		}
+		v := lookup(lookup(lookup(e.mappings, path[0]), path[1]), path[2])
+		if v == nil || v.Kind != yaml.ScalarNode {
+			return "", false
+		}
+		return v.Value, true
+	case "Fn::Join":
+		if args.Kind != yaml.SequenceNode || len(args.Children) != 2 {
+			return "", false
+		}
+		delimiter, ok := e.literal(args.Children[0])
+		if !ok {
+			return "", false
+		}
+		list, ok := e.list(args.Children[1])
+		if !ok {
+			return "", false
+		}
+		return strings.Join(list, delimiter), true
+	case "Fn::Select":
+		if args.Kind != yaml.SequenceNode || len(args.Children) != 2 {
+			return "", false
+		}
+		index, ok := e.literal(args.Children[0])
+		if !ok {
+			return "", false
+		}
+		i, err := strconv.Atoi(index)
+		if err != nil {
+			return "", false
+		}
+		list, ok := e.list(args.Children[1])
+		if !ok || i < 0 || i >= len(list) {
+			return "", false
+		}
+		return list[i], true
+	case "Fn::Sub":
+		return e.sub(args)
+	}
+	return "", false
+}
+
+// list returns the values of n if it is a list known before deployment:
+// a sequence of known values, a reference to a list parameter with a
+// known value, or an Fn::Split of known values.
+func (e *evaluator) list(n *yaml.Node) ([]string, bool) {
+	n = resolve(n)
+	if n.Kind == yaml.SequenceNode && n.Tag == "" {
+		var list []string
+		for _, c := range n.Children {
+			v, ok := e.literal(c)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, v)
+		}
+		return list, true
+	}
+
+	name, args, ok := function(n)
+	if !ok {
+		return nil, false
+	}
+
+	switch name {
+	case "Ref":
+		v, ok := e.values[args.Value]
+		if !ok {
+			return nil, false
+		}
+		return strings.Split(v, ","), true
+	case "Fn::Split":
+		if args.Kind != yaml.SequenceNode || len(args.Children) != 2 {
+			return nil, false
+		}
+		delimiter, ok := e.literal(args.Children[0])
+		if !ok {
+			return nil, false
+		}
+		v, ok := e.literal(args.Children[1])
+		if !ok {
+			return nil, false
+		}
+		return strings.Split(v, delimiter), true
+	}
+	return nil, false
+}
+
+// subVariable matches the variables of an Fn::Sub string: ${Name},
+// ${Resource.Attribute} and the escaped literal form ${!Literal}.
+var subVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// sub evaluates the arguments of an Fn::Sub, either a string or a list of
+// a string and a mapping of variables.
+func (e *evaluator) sub(args *yaml.Node) (string, bool) {
+	var template string
+	variables := make(map[string]string)
+
+	switch {
+	case args.Kind == yaml.ScalarNode:
+		template = args.Value
+	case args.Kind == yaml.SequenceNode && len(args.Children) == 2:
+		t := resolve(args.Children[0])
+		if t.Kind != yaml.ScalarNode || t.Tag != "" {
+			return "", false
+		}
+		template = t.Value
+
+		ok := true
+		pairs(args.Children[1], func(key, value *yaml.Node) {
+			if v, known := e.literal(value); known {
+				variables[key.Value] = v
+			} else {
+				ok = false
+			}
+		})
+		if !ok {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	resolved := true
+	out := subVariable.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[2 : len(match)-1]
+		if strings.HasPrefix(name, "!") {
+			return "${" + name[1:] + "}"
+		}
+		if v, ok := variables[name]; ok {
+			return v
+		}
+		if v, ok := e.values[name]; ok {
+			return v
+		}
+		resolved = false
+		return match
+	})
+	return out, resolved
+}
+
+// PseudoParameters returns the values of the pseudo parameters known for
+// a deployment to region, account and stack, any of which may be empty if
+// unknown. AWS::Partition and AWS::URLSuffix are derived from the region.
+func PseudoParameters(region, account, stack string) map[string]string {
+	values := make(map[string]string)
+	if region != "" {
+		values["AWS::Region"] = region
+		values["AWS::Partition"] = "aws"
+		values["AWS::URLSuffix"] = "amazonaws.com"
+		switch {
+		case strings.HasPrefix(region, "cn-"):
+			values["AWS::Partition"] = "aws-cn"
+			values["AWS::URLSuffix"] = "amazonaws.com.cn"
+		case strings.HasPrefix(region, "us-gov-"):
+			values["AWS::Partition"] = "aws-us-gov"
+		}
+	}
+	if account != "" {
+		values["AWS::AccountId"] = account
+	}
+	if stack != "" {
+		values["AWS::StackName"] = stack
+	}
+	return values
+}
+
+// ResolveIntrinsics replaces each Fn::FindInMap, Fn::Join, Fn::Select and
+// Fn::Sub whose inputs are all known with the literal value it produces.
+// Known inputs are literal values, Mappings entries, and the parameters
+// and pseudo parameters in values. Parameter defaults are not used, since
+// the deployment may override them. Functions that depend on anything
+// else, such as resource attributes or parameters without a value, are
+// left intact. Aliases and merge keys are resolved in the returned
+// tree; doc is left untouched.
+func ResolveIntrinsics(doc *yaml.Node, values map[string]string) (*yaml.Node, error) {
+	expanded, err := yaml.Expand(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	e := newEvaluator(expanded, values, false)
+
+	var replace func(n *yaml.Node)
+	replace = func(n *yaml.Node) {
+		for _, c := range n.Children {
+			replace(c)
+		}
+
+		name, _, ok := function(n)
+		if !ok {
+			return
+		}
+		switch name {
+		case "Fn::FindInMap", "Fn::Join", "Fn::Select", "Fn::Sub":
+			if v, ok := e.literal(n); ok {
+				n.Replace(yaml.NewScalar(v, ""))
+			}
+		}
+	}
+
+	// Mappings are inputs rather than something to resolve
+	pairs(root(expanded), func(key, value *yaml.Node) {
+		if key.Value != "Mappings" {
+			replace(value)
+		}
+	})
+
+	return expanded, nil
+}
+
+// prune replaces each Fn::If below n with the branch it selects, and
+// removes values that are AWS::NoValue. It returns nil if n itself is
+// AWS::NoValue.
+func (e *evaluator) prune(n *yaml.Node) (*yaml.Node, error) {
+	name, args, ok := function(n)
+	if ok && name == "Ref" && args.Value == "AWS::NoValue" {
+		return nil, nil
+	}
+
+	if ok && name == "Fn::If" {
+		if args.Kind != yaml.SequenceNode || len(args.Children) != 3 {
+			return nil, nodeErrorf(n, "invalid-condition", "Fn::If expects a list of a condition and two values")
+		}
+		result, known, err := e.condition(resolve(args.Children[0]).Value, n)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			// keep the Fn::If, and its branches even when they are AWS::NoValue
+			for i, branch := range args.Children[1:] {
+				pruned, err := e.prune(resolve(branch))
+				if err != nil {
+					return nil, err
+				}
+				if pruned != nil {
+					args.Children[i+1] = pruned
+				}
+			}
+			return n, nil
+		}
+		if result {
+			return e.prune(resolve(args.Children[1]))
+		}
+		return e.prune(resolve(args.Children[2]))
+	}
+
+	var children []*yaml.Node
+	for i := 0; i < len(n.Children); i++ {
+		if n.Kind == yaml.MappingNode {
+			value, err := e.prune(n.Children[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				children = append(children, n.Children[i], value)
+			}
+			i++
+			continue
+		}
+
+		c, err := e.prune(n.Children[i])
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			children = append(children, c)
+		}
+	}
+	n.Children = children
+
+	return n, nil
+}
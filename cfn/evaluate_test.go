@@ -0,0 +1,210 @@
+package cfn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateConditions(t *testing.T) {
+	const conditions = `Parameters:
+  Env: {Type: String, Default: dev}
+Conditions:
+  IsProd: !Equals [!Ref Env, prod]
+  IsUS: !Equals [!Ref 'AWS::Region', us-east-1]
+  ProdAndUS: !And [!Condition IsProd, !Condition IsUS]
+  ProdOrUS: !Or [!Condition IsProd, !Condition IsUS]
+  Unused: !Equals [a, b]
+`
+
+	tests := []struct {
+		name   string
+		src    string
+		values map[string]string
+		want   string
+	}{
+		{
+			name: "default value",
+			src:  conditions + "Resources:\n  Queue: {Type: Q, Condition: IsProd}\n  Topic: {Type: T}\n",
+			want: "Parameters:\n  Env: {Type: String, Default: dev}\nResources:\n  Topic: {Type: T}\n",
+		},
+		{
+			name:   "given value",
+			src:    conditions + "Resources:\n  Queue: {Type: Q, Condition: IsProd}\n",
+			values: map[string]string{"Env": "prod"},
+			want:   "Parameters:\n  Env: {Type: String, Default: dev}\nResources:\n  Queue: {Type: Q}\n",
+		},
+		{
+			// a value only known at deployment doesn't take the default
+			name:   "unknown value",
+			src:    conditions + "Resources:\n  Queue: {Type: Q, Condition: IsProd}\n",
+			values: map[string]string{"Env": UnknownValue},
+			want: "Parameters:\n  Env: {Type: String, Default: dev}\nConditions:\n  IsProd: !Equals [!Ref Env, prod]\n" +
+				"Resources:\n  Queue: {Type: Q, Condition: IsProd}\n",
+		},
+		{
+			name: "removed dependencies and outputs",
+			src: conditions + "Resources:\n  Queue: {Type: Q, Condition: IsProd}\n  Topic: {Type: T, DependsOn: [Queue]}\n" +
+				"Outputs:\n  Arn: {Condition: IsProd, Value: !GetAtt Queue.Arn}\n",
+			want: "Parameters:\n  Env: {Type: String, Default: dev}\nResources:\n  Topic: {Type: T}\n",
+		},
+		{
+			name:   "if branches",
+			src:    conditions + "Resources:\n  Topic:\n    Type: T\n    Properties: {A: !If [IsProd, a, b], B: !If [IsProd, !Ref 'AWS::NoValue', b]}\n",
+			values: map[string]string{"Env": "prod"},
+			want:   "Parameters:\n  Env: {Type: String, Default: dev}\nResources:\n  Topic:\n    Type: T\n    Properties: {A: a}\n",
+		},
+		{
+			// the region isn't known, so IsUS and what needs it stay
+			name: "unknown condition",
+			src:  conditions + "Resources:\n  Regional: {Type: T, Condition: IsUS}\n",
+			want: "Parameters:\n  Env: {Type: String, Default: dev}\nConditions:\n  IsUS: !Equals [!Ref 'AWS::Region', us-east-1]\n" +
+				"Resources:\n  Regional: {Type: T, Condition: IsUS}\n",
+		},
+		{
+			name: "unknown if",
+			src:  conditions + "Resources:\n  Topic:\n    Type: T\n    Properties: {A: !If [IsUS, !If [IsProd, a, b], c]}\n",
+			want: "Parameters:\n  Env: {Type: String, Default: dev}\nConditions:\n  IsUS: !Equals [!Ref 'AWS::Region', us-east-1]\n" +
+				"Resources:\n  Topic:\n    Type: T\n    Properties: {A: !If [IsUS, b, c]}\n",
+		},
+		{
+			// a known false decides Fn::And without the unknown region
+			name: "and short circuit",
+			src:  conditions + "Resources:\n  Both: {Type: T, Condition: ProdAndUS}\n",
+			want: "Parameters:\n  Env: {Type: String, Default: dev}\nResources: {}\n",
+		},
+		{
+			// a known true decides Fn::Or without the unknown region
+			name:   "or short circuit",
+			src:    conditions + "Resources:\n  Either: {Type: T, Condition: ProdOrUS}\n",
+			values: map[string]string{"Env": "prod"},
+			want:   "Parameters:\n  Env: {Type: String, Default: dev}\nResources:\n  Either: {Type: T}\n",
+		},
+		{
+			name: "or needs the unknown",
+			src:  conditions + "Resources:\n  Either: {Type: T, Condition: ProdOrUS}\n",
+			want: "Parameters:\n  Env: {Type: String, Default: dev}\nConditions:\n  IsProd: !Equals [!Ref Env, prod]\n" +
+				"  IsUS: !Equals [!Ref 'AWS::Region', us-east-1]\n  ProdOrUS: !Or [!Condition IsProd, !Condition IsUS]\n" +
+				"Resources:\n  Either: {Type: T, Condition: ProdOrUS}\n",
+		},
+		{
+			name:   "pseudo parameters",
+			src:    conditions + "Resources:\n  Both: {Type: T, Condition: ProdAndUS}\n",
+			values: map[string]string{"Env": "prod", "AWS::Region": "us-east-1"},
+			want:   "Parameters:\n  Env: {Type: String, Default: dev}\nResources:\n  Both: {Type: T}\n",
+		},
+		{
+			name: "not",
+			src:  "Conditions:\n  Dev: !Not [!Equals [a, b]]\nResources:\n  R: {Type: T, Condition: Dev}\n",
+			want: "Resources:\n  R: {Type: T}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			before := marshal(t, doc)
+
+			out, err := EvaluateConditions(doc, test.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := marshal(t, out); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+			if after := marshal(t, doc); after != before {
+				t.Errorf("source changed from %q to %q", before, after)
+			}
+		})
+	}
+}
+
+func TestEvaluateConditionsErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{
+			"Conditions:\n  A: !Condition B\n  B: !Condition A\nResources:\n  R: {Type: T, Condition: A}\n",
+			"3:6: condition A refers to itself: A -> B -> A [condition-cycle]",
+		},
+		{
+			"Conditions:\n  A: !Equals [1]\nResources:\n  R: {Type: T, Condition: A}\n",
+			"2:6: Fn::Equals expects a list of two values [invalid-condition]",
+		},
+		{
+			"Resources:\n  R: {Type: T, Condition: Missing}\n",
+			"2:27: unknown condition Missing [unknown-condition]",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := EvaluateConditions(parse(t, test.src), nil)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("got %v, want %s", err, test.want)
+		}
+	}
+}
+
+func TestPseudoParameters(t *testing.T) {
+	tests := []struct {
+		region, account, stack string
+		want                   map[string]string
+	}{
+		{"", "", "", map[string]string{}},
+		{"us-east-1", "123456789012", "app", map[string]string{
+			"AWS::Region": "us-east-1", "AWS::Partition": "aws", "AWS::URLSuffix": "amazonaws.com",
+			"AWS::AccountId": "123456789012", "AWS::StackName": "app",
+		}},
+		{"cn-north-1", "", "", map[string]string{
+			"AWS::Region": "cn-north-1", "AWS::Partition": "aws-cn", "AWS::URLSuffix": "amazonaws.com.cn",
+		}},
+		{"us-gov-west-1", "", "", map[string]string{
+			"AWS::Region": "us-gov-west-1", "AWS::Partition": "aws-us-gov", "AWS::URLSuffix": "amazonaws.com",
+		}},
+	}
+
+	for _, test := range tests {
+		if got := PseudoParameters(test.region, test.account, test.stack); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("PseudoParameters(%q, %q, %q) = %v, want %v", test.region, test.account, test.stack, got, test.want)
+		}
+	}
+}
+
+func TestResolveIntrinsics(t *testing.T) {
+	const header = "Parameters:\n  Env: {Type: String, Default: dev}\nMappings:\n  Regions:\n    us-east-1: {Ami: ami-1}\n"
+	region := map[string]string{"Env": "prod", "AWS::Region": "us-east-1"}
+
+	tests := []struct {
+		name   string
+		props  string
+		values map[string]string
+		want   string
+	}{
+		{"sub", "A: !Sub 'app-${Env}'", region, "A: app-prod"},
+		{"sub variables", "A: !Sub ['${A}-${B}', {A: x, B: !Ref Env}]", region, "A: x-prod"},
+		{"sub escaped", "A: !Sub 'a-${!Literal}'", region, "A: a-${Literal}"},
+		{"join", "A: !Join ['-', [a, !Ref Env, b]]", region, "A: a-prod-b"},
+		{"empty join", "A: !Join ['', []]", region, "A: ''"},
+		{"find in map", "A: !FindInMap [Regions, !Ref 'AWS::Region', Ami]", region, "A: ami-1"},
+		{"select", "A: !Select [1, [x, 'on', z]]", region, "A: 'on'"},
+		{"select out of range", "A: !Select [5, [x]]", region, "A: !Select [5, [x]]"},
+		{"resource attribute", "A: !Sub '${Bucket.Arn}/x'", region, "A: !Sub '${Bucket.Arn}/x'"},
+		{"unknown pseudo parameter", "A: !Sub 'app-${AWS::AccountId}'", region, "A: !Sub 'app-${AWS::AccountId}'"},
+		// the deployment may override a default
+		{"default", "A: !Sub 'app-${Env}'", nil, "A: !Sub 'app-${Env}'"},
+		{"default in join", "A: !Join ['-', [a, !Ref Env]]", nil, "A: !Join ['-', [a, !Ref Env]]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := header + "Resources:\n  R:\n    Type: T\n    Properties:\n      " + test.props + "\n"
+			out, err := ResolveIntrinsics(parse(t, src), test.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := header + "Resources:\n  R:\n    Type: T\n    Properties:\n      " + test.want + "\n"
+			if got := marshal(t, out); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
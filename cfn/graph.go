@@ -0,0 +1,78 @@
+package cfn
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// A Dependency is an edge of a resource graph: resource From depends on
+// resource To through Kind, one of Ref, Fn::GetAtt, Fn::Sub or DependsOn.
+type Dependency struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+func (d Dependency) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", d.From, d.To, d.Kind)
+}
+
+// A Graph holds the resources of a template and the dependencies between
+// them.
+type Graph struct {
+	Resources    []string     `json:"resources"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// ResourceGraph returns the resources of doc in document order and their
+// dependencies on each other, through intrinsic functions or DependsOn.
+// Each dependency is listed once per kind.
+func ResourceGraph(doc *yaml.Node) (*Graph, error) {
+	expanded, err := yaml.Expand(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := section(expanded, "Resources")
+	g := &Graph{Resources: keys(resources)}
+
+	declared := make(map[string]bool)
+	for _, name := range g.Resources {
+		declared[name] = true
+	}
+
+	seen := make(map[Dependency]bool)
+	pairs(resources, func(key, value *yaml.Node) {
+		refs := append(attributeReferences(value), references(value)...)
+		for _, r := range refs {
+			if r.kind == "Condition" || r.kind == "Fn::FindInMap" || !declared[r.name] {
+				continue
+			}
+			d := Dependency{From: key.Value, To: r.name, Kind: r.kind}
+			if !seen[d] {
+				seen[d] = true
+				g.Dependencies = append(g.Dependencies, d)
+			}
+		}
+	})
+
+	return g, nil
+}
+
+// DOT returns g in the Graphviz DOT language, with each dependency drawn
+// from the dependent resource to the one it depends on.
+func (g *Graph) DOT() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("digraph resources {\n")
+	for _, r := range g.Resources {
+		fmt.Fprintf(&buf, "  %s;\n", strconv.Quote(r))
+	}
+	for _, d := range g.Dependencies {
+		fmt.Fprintf(&buf, "  %s -> %s [label=%s];\n", strconv.Quote(d.From), strconv.Quote(d.To), strconv.Quote(d.Kind))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
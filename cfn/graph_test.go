@@ -0,0 +1,38 @@
+package cfn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceGraph(t *testing.T) {
+	g, err := ResourceGraph(parse(t, lintTemplateSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"Bucket", "Queue", "Topic"}; !reflect.DeepEqual(g.Resources, want) {
+		t.Errorf("got resources %v, want %v", g.Resources, want)
+	}
+	// references to parameters and undeclared resources aren't dependencies
+	want := []Dependency{
+		{"Queue", "Bucket", "Fn::Sub"},
+		{"Topic", "Bucket", "DependsOn"},
+		{"Topic", "Bucket", "Fn::GetAtt"},
+		{"Topic", "Bucket", "Ref"},
+	}
+	if !reflect.DeepEqual(g.Dependencies, want) {
+		t.Errorf("got dependencies %v, want %v", g.Dependencies, want)
+	}
+}
+
+func TestGraphDOT(t *testing.T) {
+	g := &Graph{
+		Resources:    []string{"A", "B"},
+		Dependencies: []Dependency{{"A", "B", "Ref"}},
+	}
+	want := "digraph resources {\n  \"A\";\n  \"B\";\n  \"A\" -> \"B\" [label=\"Ref\"];\n}\n"
+	if got := string(g.DOT()); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package cfn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// DefaultMaxIncludeSize is the largest file, in bytes, that may be inlined
+// by an include tag unless configured otherwise.
+const DefaultMaxIncludeSize = 1 << 20
+
+// includeTags lists the tags replaced by the contents of the file they name.
+var includeTags = map[string]func(n *yaml.Node, path string, data []byte) error{
+	"!File":       includeText,
+	"!FileBase64": includeBase64,
+	"!Base64File": includeBase64,
+	"!FileJSON":   includeJSON,
+}
+
+// Include replaces every !File, !FileBase64 (or !Base64File) and !FileJSON
+// tagged scalar in the tree with the contents of the file it names:
+// as a literal block scalar, as a base64 encoded scalar, or as the parsed
+// structure of the file respectively. Relative paths are resolved against
+// dir, normally the directory of the template. Files larger than maxSize
+// bytes are rejected.
+func Include(n *yaml.Node, dir string, maxSize int64) error {
+	_, err := IncludeFiles(n, dir, maxSize)
+	return err
+}
+
+// IncludeFiles is like Include but also returns the paths of the files it
+// included or tried to include, in the order they appear. A file that
+// can't be included doesn't stop the others: every problem is returned
+// together as a yaml.ErrorList.
+func IncludeFiles(n *yaml.Node, dir string, maxSize int64) ([]string, error) {
+	var files []string
+	var errs yaml.ErrorList
+	includeNode(n, dir, maxSize, &files, &errs)
+	if len(errs) > 0 {
+		return files, errs
+	}
+	return files, nil
+}
+
+func includeNode(n *yaml.Node, dir string, maxSize int64, files *[]string, errs *yaml.ErrorList) {
+	if n == nil || n.Kind == yaml.AliasNode {
+		return
+	}
+
+	if include, ok := includeTags[n.Tag]; ok {
+		if n.Kind != yaml.ScalarNode {
+			*errs = append(*errs, nodeErrorf(n, "invalid-include", "%s expects a file path", n.Tag))
+			return
+		}
+
+		path := n.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		*files = append(*files, path)
+
+		data, err := readInclude(path, maxSize)
+		if err != nil {
+			*errs = append(*errs, nodeErrorf(n, "include", "%s %s: %v", n.Tag, n.Value, err))
+			return
+		}
+
+		if err := include(n, path, data); err != nil {
+			*errs = append(*errs, nodeErrorf(n, "include", "%s %s: %v", n.Tag, n.Value, err))
+		}
+		return
+	}
+
+	for _, c := range n.Children {
+		includeNode(c, dir, maxSize, files, errs)
+	}
+}
+
+func readInclude(path string, maxSize int64) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return nil, fmt.Errorf("file is %d bytes, exceeding the limit of %d", info.Size(), maxSize)
+	}
+	return ioutil.ReadFile(path)
+}
+
+func includeText(n *yaml.Node, path string, data []byte) error {
+	n.Replace(yaml.NewLiteralScalar(string(data)))
+	return nil
+}
+
+func includeBase64(n *yaml.Node, path string, data []byte) error {
+	n.Replace(yaml.NewScalar(base64.StdEncoding.EncodeToString(data), ""))
+	return nil
+}
+
+func includeJSON(n *yaml.Node, path string, data []byte) error {
+	doc, err := yaml.UnmarshalToTree(data, false)
+	if err != nil {
+		return err
+	}
+	if doc == nil || len(doc.Children) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+	doc.SetFile(path)
+	n.Replace(doc.Children[0])
+	return nil
+}
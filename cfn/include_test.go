@@ -0,0 +1,123 @@
+package cfn
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+func TestIncludeFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"script.sh":   "#!/bin/sh\necho hi\n",
+		"data.bin":    "hello",
+		"policy.json": `{"Version": "2012-10-17", "Statement": []}`,
+		"empty.json":  "",
+		"large.txt":   strings.Repeat("x", 100),
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		files   []string
+		errCode string
+	}{
+		{
+			name:  "text",
+			src:   "A: !File script.sh\n",
+			want:  "A: |\n  #!/bin/sh\n  echo hi\n",
+			files: []string{"script.sh"},
+		},
+		{
+			name:  "base64",
+			src:   "A: !FileBase64 data.bin\nB: !Base64File data.bin\n",
+			want:  "A: aGVsbG8=\nB: aGVsbG8=\n",
+			files: []string{"data.bin", "data.bin"},
+		},
+		{
+			name:  "json",
+			src:   "A: !FileJSON policy.json\n",
+			want:  "A: {\"Version\": \"2012-10-17\", \"Statement\": []}\n",
+			files: []string{"policy.json"},
+		},
+		{
+			name:  "absolute path",
+			src:   "A: !File " + filepath.Join(dir, "data.bin") + "\n",
+			want:  "A: |-\n  hello\n",
+			files: []string{"data.bin"},
+		},
+		{
+			name:    "missing file",
+			src:     "A: !File missing.txt\n",
+			files:   []string{"missing.txt"},
+			errCode: "include",
+		},
+		{
+			name:    "too large",
+			src:     "A: !File large.txt\n",
+			files:   []string{"large.txt"},
+			errCode: "include",
+		},
+		{
+			name:    "empty json",
+			src:     "A: !FileJSON empty.json\n",
+			files:   []string{"empty.json"},
+			errCode: "include",
+		},
+		{
+			name:    "not a path",
+			src:     "A: !File [a, b]\n",
+			errCode: "invalid-include",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			got, err := IncludeFiles(doc, dir, 50)
+
+			var want []string
+			for _, name := range test.files {
+				want = append(want, filepath.Join(dir, name))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got files %v, want %v", got, want)
+			}
+
+			if test.errCode != "" {
+				errs, ok := err.(yaml.ErrorList)
+				if !ok || len(errs) != 1 || errs[0].Code != test.errCode {
+					t.Fatalf("got error %v, want one %s error", err, test.errCode)
+				}
+				if errs[0].Line != 1 || errs[0].Column != 4 {
+					t.Errorf("got error at %d:%d, want 1:4", errs[0].Line, errs[0].Column)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out := marshal(t, doc); out != test.want {
+				t.Errorf("got %q, want %q", out, test.want)
+			}
+		})
+	}
+}
+
+func TestIncludeFilesReportsEveryProblem(t *testing.T) {
+	doc := parse(t, "A: !File a.txt\nB: !File b.txt\n")
+	_, err := IncludeFiles(doc, t.TempDir(), 0)
+	if errs, ok := err.(yaml.ErrorList); !ok || len(errs) != 2 {
+		t.Errorf("got %v, want two errors", err)
+	}
+}
@@ -0,0 +1,141 @@
+package cfn
+
+import (
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// intrinsics maps the short form tag of each intrinsic function to the key
+// used by its long form.
+var intrinsics = map[string]string{
+	"!Ref":         "Ref",
+	"!Condition":   "Condition",
+	"!Base64":      "Fn::Base64",
+	"!Cidr":        "Fn::Cidr",
+	"!FindInMap":   "Fn::FindInMap",
+	"!GetAtt":      "Fn::GetAtt",
+	"!GetAZs":      "Fn::GetAZs",
+	"!ImportValue": "Fn::ImportValue",
+	"!Join":        "Fn::Join",
+	"!Select":      "Fn::Select",
+	"!Split":       "Fn::Split",
+	"!Sub":         "Fn::Sub",
+	"!Transform":   "Fn::Transform",
+	"!And":         "Fn::And",
+	"!Equals":      "Fn::Equals",
+	"!If":          "Fn::If",
+	"!Not":         "Fn::Not",
+	"!Or":          "Fn::Or",
+}
+
+// shortTags is the inverse of intrinsics.
+var shortTags = func() map[string]string {
+	m := make(map[string]string, len(intrinsics))
+	for tag, key := range intrinsics {
+		m[key] = tag
+	}
+	return m
+}()
+
+// ToLongForm rewrites every short form intrinsic function in the tree,
+// such as !Ref, into its long form mapping, such as Ref. !GetAtt Res.Attr
+// becomes the list form Fn::GetAtt: [Res, Attr].
+func ToLongForm(n *yaml.Node) {
+	if n == nil || n.Kind == yaml.AliasNode {
+		return
+	}
+
+	if key, ok := intrinsics[n.Tag]; ok {
+		value := *n
+		value.Tag = ""
+		value.Anchor = ""
+
+		if key == "Fn::GetAtt" && value.Kind == yaml.ScalarNode {
+			parts := strings.SplitN(value.Value, ".", 2)
+			if len(parts) == 2 {
+				value = *yaml.NewSequence(yaml.NewScalar(parts[0], ""), yaml.NewScalar(parts[1], ""))
+			}
+		}
+
+		n.Replace(yaml.NewMapping(yaml.NewScalar(key, ""), &value))
+	}
+
+	for _, c := range n.Children {
+		ToLongForm(c)
+	}
+}
+
+// conditionFunctions are the long form keys of the functions whose
+// arguments can use the Condition function.
+var conditionFunctions = map[string]bool{
+	"Fn::And": true,
+	"Fn::Or":  true,
+	"Fn::Not": true,
+	"Fn::If":  true,
+}
+
+// ToShortForm rewrites every long form intrinsic function in the tree into
+// its short form tag. A function whose argument already carries a tag,
+// such as Fn::Base64: !Sub ..., is left in long form since YAML does not
+// allow a node to have two tags, as is one written as a tagged mapping,
+// such as !Base64 {Fn::Sub: ...}. A mapping with a single Condition key is
+// only the Condition function as an argument of a condition function, such
+// as Fn::And; elsewhere, such as a property named Condition, it is kept.
+func ToShortForm(n *yaml.Node) {
+	toShortForm(n, false, false)
+}
+
+// toShortForm is ToShortForm for n, which is the argument list of a
+// condition function if args is set, or one of its arguments if inCondition
+// is set.
+func toShortForm(n *yaml.Node, args bool, inCondition bool) {
+	if n == nil || n.Kind == yaml.AliasNode {
+		return
+	}
+
+	args = args || (n.Kind == yaml.SequenceNode && conditionFunctions[intrinsics[n.Tag]])
+	function := n.Kind == yaml.MappingNode && len(n.Children) == 2 && conditionFunctions[n.Children[0].Value]
+
+	for i, c := range n.Children {
+		toShortForm(c, function && i == 1, args)
+	}
+
+	if n.Kind != yaml.MappingNode || len(n.Children) != 2 || n.Tag != "" {
+		return
+	}
+
+	key, value := n.Children[0], n.Children[1]
+	tag, ok := shortTags[key.Value]
+	if !ok || key.Kind != yaml.ScalarNode || key.Tag != "" {
+		return
+	}
+	if value.Kind == yaml.AliasNode || value.Tag != "" || value.Anchor != "" {
+		return
+	}
+	if key.Value == "Condition" && (!inCondition || value.Kind != yaml.ScalarNode) {
+		return
+	}
+
+	short := *value
+	short.Tag = tag
+
+	if key.Value == "Fn::GetAtt" && isPlainPair(value) {
+		short = *yaml.NewScalar(value.Children[0].Value+"."+value.Children[1].Value, tag)
+	}
+
+	n.Replace(&short)
+}
+
+// isPlainPair reports whether n is a sequence of two untagged scalars.
+func isPlainPair(n *yaml.Node) bool {
+	if n.Kind != yaml.SequenceNode || len(n.Children) != 2 {
+		return false
+	}
+	for _, c := range n.Children {
+		if c.Kind != yaml.ScalarNode || c.Tag != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package cfn
+
+import (
+	"testing"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// parse parses src, failing the test if it isn't valid YAML.
+func parse(t *testing.T, src string) *yaml.Node {
+	t.Helper()
+	doc, err := yaml.UnmarshalToTree([]byte(src), false)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	return doc
+}
+
+// marshal emits doc keeping its style, failing the test if it can't.
+func marshal(t *testing.T, doc *yaml.Node) string {
+	t.Helper()
+	out, err := yaml.MarshalFromTree(doc, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestToLongForm(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"A: !Ref X\n", "A:\n  Ref: X\n"},
+		{"A: !GetAtt R.Arn\n", "A:\n  Fn::GetAtt:\n  - R\n  - Arn\n"},
+		{"A: !GetAtt [R, Arn]\n", "A:\n  Fn::GetAtt: [R, Arn]\n"},
+		{"A: !Sub 'a-${X}'\n", "A:\n  Fn::Sub: 'a-${X}'\n"},
+		{"A: !Join ['', [a, !Ref X]]\n", "A:\n  Fn::Join: ['', [a, {Ref: X}]]\n"},
+		{"A: !Condition IsProd\n", "A:\n  Condition: IsProd\n"},
+		{"A: !Custom X\n", "A: !Custom X\n"},
+		{"A: &a !Ref X\nB: *a\n", "A: &a\n  Ref: X\nB: *a\n"},
+	}
+
+	for _, test := range tests {
+		doc := parse(t, test.src)
+		ToLongForm(doc)
+		if got := marshal(t, doc); got != test.want {
+			t.Errorf("ToLongForm(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestToShortForm(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"A: {Ref: X}\n", "A: !Ref X\n"},
+		{"A: {Fn::GetAtt: [R, Arn]}\n", "A: !GetAtt R.Arn\n"},
+		{"A: {Fn::Join: ['', [a, {Ref: X}]]}\n", "A: !Join ['', [a, !Ref X]]\n"},
+		{"A: {Fn::And: [{Condition: A}, {Condition: B}]}\n", "A: !And [!Condition A, !Condition B]\n"},
+		{"A: !Or [{Condition: A}, {Fn::Not: [{Condition: B}]}]\n", "A: !Or [!Condition A, !Not [!Condition B]]\n"},
+		// a property named Condition isn't a function
+		{"A: {Condition: IsProd}\n", "A: {Condition: IsProd}\n"},
+		{"A: {Fn::Equals: [{Condition: X}, a]}\n", "A: !Equals [{Condition: X}, a]\n"},
+		{"A: {Fn::And: [{Condition: [a]}]}\n", "A: !And [{Condition: [a]}]\n"},
+		// YAML doesn't allow a node two tags
+		{"A: {Fn::Base64: !Sub x}\n", "A: {'Fn::Base64': !Sub x}\n"},
+		{"A: !Base64 {Fn::Sub: x}\n", "A: !Base64 {'Fn::Sub': x}\n"},
+		{"A: {Fn::Join: [',', [a]], Other: 1}\n", "A: {'Fn::Join': [',', [a]], Other: 1}\n"},
+		{"A: {Fn::Unknown: x}\n", "A: {'Fn::Unknown': x}\n"},
+	}
+
+	for _, test := range tests {
+		doc := parse(t, test.src)
+		ToShortForm(doc)
+		if got := marshal(t, doc); got != test.want {
+			t.Errorf("ToShortForm(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestIntrinsicFormsRoundTrip(t *testing.T) {
+	srcs := []string{
+		"A: !Ref X\n",
+		"A: !GetAtt R.Arn\n",
+		"A: !Join ['', [a, !Ref X, !GetAtt R.Arn]]\n",
+		"A: !If [IsProd, !Ref X, !Ref 'AWS::NoValue']\n",
+		"A: !And [!Condition A, !Not [!Condition B]]\n",
+	}
+
+	for _, src := range srcs {
+		doc := parse(t, src)
+		want := marshal(t, doc)
+		ToLongForm(doc)
+		ToShortForm(doc)
+		if got := marshal(t, doc); got != want {
+			t.Errorf("round trip of %q = %q, want %q", src, got, want)
+		}
+	}
+}
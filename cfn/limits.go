@@ -0,0 +1,106 @@
+package cfn
+
+import (
+	"fmt"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// Limits holds the CloudFormation quotas a template is checked against.
+// A zero value disables the corresponding check.
+type Limits struct {
+	MaxBodySize          int
+	MaxResources         int
+	MaxParameters        int
+	MaxOutputs           int
+	MaxMappings          int
+	MaxMappingAttributes int
+	MaxNameLength        int
+}
+
+// DefaultLimits are the quotas CloudFormation applies to a template body
+// passed directly to the API. Templates uploaded to S3 may be up to 1 MB.
+var DefaultLimits = Limits{
+	MaxBodySize:          51200,
+	MaxResources:         500,
+	MaxParameters:        200,
+	MaxOutputs:           200,
+	MaxMappings:          200,
+	MaxMappingAttributes: 200,
+	MaxNameLength:        255,
+}
+
+// A LimitViolation describes a single quota exceeded by a template.
+type LimitViolation struct {
+	Limit string // The quota that was exceeded, e.g. "resources".
+	Name  string // The offending name, for per-name quotas.
+	Value int
+	Max   int
+}
+
+func (v LimitViolation) Error() string {
+	switch {
+	case v.Name == "":
+		return fmt.Sprintf("template has %d %s, exceeding the limit of %d", v.Value, v.Limit, v.Max)
+	case v.Limit == "mapping attributes":
+		return fmt.Sprintf("mapping %q has %d attributes, exceeding the limit of %d", v.Name, v.Value, v.Max)
+	default:
+		return fmt.Sprintf("%s %q is %d characters long, exceeding the limit of %d", v.Limit, v.Name, v.Value, v.Max)
+	}
+}
+
+// CheckLimits checks the emitted template out against limits. Counts are
+// taken from the emitted document rather than the source tree, with its
+// aliases and merge keys resolved, so that entries merged in with << are
+// counted and the << keys themselves are not.
+func CheckLimits(out []byte, limits Limits) ([]LimitViolation, error) {
+	var violations []LimitViolation
+
+	check := func(limit string, value, max int) {
+		if max > 0 && value > max {
+			violations = append(violations, LimitViolation{Limit: limit, Value: value, Max: max})
+		}
+	}
+
+	checkNames := func(limit string, names []string) {
+		for _, name := range names {
+			if limits.MaxNameLength > 0 && len(name) > limits.MaxNameLength {
+				violations = append(violations, LimitViolation{Limit: limit, Name: name, Value: len(name), Max: limits.MaxNameLength})
+			}
+		}
+	}
+
+	check("bytes", len(out), limits.MaxBodySize)
+
+	doc, err := yaml.UnmarshalToTree(out, false)
+	if err == nil {
+		doc, err = yaml.Expand(doc)
+	}
+	if err != nil {
+		return violations, err
+	}
+
+	resources := keys(section(doc, "Resources"))
+	parameters := keys(section(doc, "Parameters"))
+	outputs := keys(section(doc, "Outputs"))
+	mappings := section(doc, "Mappings")
+
+	check("resources", len(resources), limits.MaxResources)
+	check("parameters", len(parameters), limits.MaxParameters)
+	check("outputs", len(outputs), limits.MaxOutputs)
+	check("mappings", len(keys(mappings)), limits.MaxMappings)
+
+	checkNames("resource name", resources)
+	checkNames("parameter name", parameters)
+	checkNames("output name", outputs)
+	checkNames("mapping name", keys(mappings))
+
+	for _, name := range keys(mappings) {
+		attributes := len(keys(lookup(mappings, name)))
+		if limits.MaxMappingAttributes > 0 && attributes > limits.MaxMappingAttributes {
+			violations = append(violations, LimitViolation{Limit: "mapping attributes", Name: name, Value: attributes, Max: limits.MaxMappingAttributes})
+		}
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,115 @@
+package cfn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckLimits(t *testing.T) {
+	small := Limits{
+		MaxBodySize:          1000,
+		MaxResources:         2,
+		MaxParameters:        1,
+		MaxOutputs:           1,
+		MaxMappings:          1,
+		MaxMappingAttributes: 1,
+		MaxNameLength:        8,
+	}
+
+	tests := []struct {
+		name   string
+		src    string
+		limits Limits
+		want   []LimitViolation
+	}{
+		{
+			name:   "within limits",
+			src:    "Parameters:\n  Env: {Type: String}\nResources:\n  A: {Type: T}\n  B: {Type: T}\n",
+			limits: small,
+		},
+		{
+			name:   "too many resources",
+			src:    "Resources:\n  A: {Type: T}\n  B: {Type: T}\n  C: {Type: T}\n",
+			limits: small,
+			want:   []LimitViolation{{Limit: "resources", Value: 3, Max: 2}},
+		},
+		{
+			name:   "too many parameters and outputs",
+			src:    "Parameters:\n  A: {Type: String}\n  B: {Type: String}\nOutputs:\n  A: {Value: 1}\n  B: {Value: 2}\n",
+			limits: small,
+			want: []LimitViolation{
+				{Limit: "parameters", Value: 2, Max: 1},
+				{Limit: "outputs", Value: 2, Max: 1},
+			},
+		},
+		{
+			// the merged entries are counted rather than the << key
+			name:   "merged resources",
+			src:    "Common: &common\n  A: {Type: T}\n  B: {Type: T}\nResources:\n  <<: *common\n  C: {Type: T}\n",
+			limits: small,
+			want:   []LimitViolation{{Limit: "resources", Value: 3, Max: 2}},
+		},
+		{
+			// nor is an entry that overrides a merged one
+			name:   "overridden parameter",
+			src:    "Parameters:\n  <<: {Env: {Type: String}}\n  Env: {Type: String, Default: dev}\n",
+			limits: small,
+		},
+		{
+			name:   "too large",
+			src:    "Description: " + strings.Repeat("x", 1000) + "\n",
+			limits: small,
+			want:   []LimitViolation{{Limit: "bytes", Value: 1014, Max: 1000}},
+		},
+		{
+			name:   "long names",
+			src:    "Resources:\n  LongResourceName: {Type: T}\nOutputs:\n  LongOutputName: {Value: 1}\n",
+			limits: small,
+			want: []LimitViolation{
+				{Limit: "resource name", Name: "LongResourceName", Value: 16, Max: 8},
+				{Limit: "output name", Name: "LongOutputName", Value: 14, Max: 8},
+			},
+		},
+		{
+			name:   "mapping attributes",
+			src:    "Mappings:\n  M:\n    a: {x: 1}\n    b: {x: 2}\n",
+			limits: small,
+			want:   []LimitViolation{{Limit: "mapping attributes", Name: "M", Value: 2, Max: 1}},
+		},
+		{
+			name:   "zero limits are disabled",
+			src:    "Resources:\n  A: {Type: T}\n  B: {Type: T}\n  C: {Type: T}\n",
+			limits: Limits{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := CheckLimits([]byte(test.src), test.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLimitViolationError(t *testing.T) {
+	tests := []struct {
+		v    LimitViolation
+		want string
+	}{
+		{LimitViolation{Limit: "resources", Value: 501, Max: 500}, "template has 501 resources, exceeding the limit of 500"},
+		{LimitViolation{Limit: "mapping attributes", Name: "M", Value: 201, Max: 200}, `mapping "M" has 201 attributes, exceeding the limit of 200`},
+		{LimitViolation{Limit: "resource name", Name: "R", Value: 300, Max: 255}, `resource name "R" is 300 characters long, exceeding the limit of 255`},
+	}
+
+	for _, test := range tests {
+		if got := test.v.Error(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package cfn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// A Problem is a likely mistake found in a template by a lint rule.
+type Problem struct {
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d, column %d: %s (%s)", p.Line, p.Column, p.Message, p.Rule)
+}
+
+// A LintRule checks templates for one kind of likely mistake.
+type LintRule struct {
+	Name        string
+	Description string
+	check       func(t *lintTemplate) []Problem
+}
+
+// LintRules are the rules Lint checks.
+var LintRules = []LintRule{
+	{"missing-type", "resources must have a Type", checkMissingType},
+	{"undefined-ref", "Ref and Fn::Sub must refer to a parameter, resource or pseudo parameter", checkUndefinedRef},
+	{"undefined-getatt", "Fn::GetAtt must refer to a resource", checkUndefinedGetAtt},
+	{"undefined-dependency", "DependsOn must name a resource", checkUndefinedDependency},
+	{"undefined-condition", "conditions used must be declared", checkUndefinedCondition},
+	{"undefined-mapping", "Fn::FindInMap must refer to a declared mapping", checkUndefinedMapping},
+	{"unused-parameter", "parameters should be referred to", checkUnusedParameter},
+	{"unused-condition", "conditions should be used", checkUnusedCondition},
+	{"unused-mapping", "mappings should be referred to", checkUnusedMapping},
+}
+
+// lintTemplate is an expanded template and the names it declares and
+// refers to.
+type lintTemplate struct {
+	parameters map[string]*yaml.Node
+	resources  map[string]*yaml.Node
+	conditions map[string]*yaml.Node
+	mappings   map[string]*yaml.Node
+	// order holds the declared names of each section in document order.
+	order map[string][]string
+	refs  []reference
+	// resourceTypes holds the Type of each resource, or nil if it has none.
+	resourceTypes map[string]*yaml.Node
+}
+
+// Lint checks doc with the named rules, or with every rule if names is
+// empty, and returns the problems found in document order.
+func Lint(doc *yaml.Node, names []string) ([]Problem, error) {
+	rules := LintRules
+	if len(names) > 0 {
+		rules = nil
+		for _, name := range names {
+			rule, ok := lintRule(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown lint rule %s", name)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	expanded, err := yaml.Expand(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newLintTemplate(expanded)
+
+	var problems []Problem
+	for _, rule := range rules {
+		for _, p := range rule.check(t) {
+			p.Rule = rule.Name
+			problems = append(problems, p)
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+	return problems, nil
+}
+
+func lintRule(name string) (LintRule, bool) {
+	for _, rule := range LintRules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return LintRule{}, false
+}
+
+func newLintTemplate(doc *yaml.Node) *lintTemplate {
+	t := &lintTemplate{
+		parameters:    make(map[string]*yaml.Node),
+		resources:     make(map[string]*yaml.Node),
+		conditions:    make(map[string]*yaml.Node),
+		mappings:      make(map[string]*yaml.Node),
+		order:         make(map[string][]string),
+		resourceTypes: make(map[string]*yaml.Node),
+	}
+
+	declare := func(name string, declared map[string]*yaml.Node) {
+		pairs(section(doc, name), func(key, value *yaml.Node) {
+			declared[key.Value] = key
+			t.order[name] = append(t.order[name], key.Value)
+		})
+	}
+	declare("Parameters", t.parameters)
+	declare("Resources", t.resources)
+	declare("Conditions", t.conditions)
+	declare("Mappings", t.mappings)
+
+	pairs(section(doc, "Resources"), func(key, value *yaml.Node) {
+		t.resourceTypes[key.Value] = lookup(value, "Type")
+		t.refs = append(t.refs, attributeReferences(value)...)
+	})
+	pairs(section(doc, "Outputs"), func(key, value *yaml.Node) {
+		t.refs = append(t.refs, attributeReferences(value)...)
+	})
+
+	for _, name := range []string{"Conditions", "Resources", "Outputs", "Metadata"} {
+		t.refs = append(t.refs, references(section(doc, name))...)
+	}
+
+	return t
+}
+
+func problemAt(n *yaml.Node, format string, args ...interface{}) Problem {
+	return Problem{Line: n.Line(), Column: n.Column(), Message: fmt.Sprintf(format, args...)}
+}
+
+func checkMissingType(t *lintTemplate) []Problem {
+	var problems []Problem
+	for _, name := range t.order["Resources"] {
+		if t.resourceTypes[name] == nil {
+			problems = append(problems, problemAt(t.resources[name], "resource %s has no Type", name))
+		}
+	}
+	return problems
+}
+
+func checkUndefinedRef(t *lintTemplate) []Problem {
+	var problems []Problem
+	for _, r := range t.refs {
+		if r.kind != "Ref" && r.kind != "Fn::Sub" {
+			continue
+		}
+		if strings.HasPrefix(r.name, "AWS::") || t.parameters[r.name] != nil || t.resources[r.name] != nil {
+			continue
+		}
+		problems = append(problems, problemAt(r.at, "%s refers to %s, which is not a parameter or resource", r.kind, r.name))
+	}
+	return problems
+}
+
+func checkUndefinedGetAtt(t *lintTemplate) []Problem {
+	return undefined(t, "Fn::GetAtt", t.resources, "resource")
+}
+
+func checkUndefinedDependency(t *lintTemplate) []Problem {
+	return undefined(t, "DependsOn", t.resources, "resource")
+}
+
+func checkUndefinedCondition(t *lintTemplate) []Problem {
+	return undefined(t, "Condition", t.conditions, "condition")
+}
+
+func checkUndefinedMapping(t *lintTemplate) []Problem {
+	return undefined(t, "Fn::FindInMap", t.mappings, "mapping")
+}
+
+// undefined reports the references of kind to names that aren't declared.
+func undefined(t *lintTemplate, kind string, declared map[string]*yaml.Node, what string) []Problem {
+	var problems []Problem
+	for _, r := range t.refs {
+		if r.kind == kind && declared[r.name] == nil {
+			problems = append(problems, problemAt(r.at, "%s refers to %s, which is not a declared %s", kind, r.name, what))
+		}
+	}
+	return problems
+}
+
+func checkUnusedParameter(t *lintTemplate) []Problem {
+	return unused(t, "Parameters", t.parameters, "parameter", "Ref", "Fn::Sub")
+}
+
+func checkUnusedCondition(t *lintTemplate) []Problem {
+	return unused(t, "Conditions", t.conditions, "condition", "Condition")
+}
+
+func checkUnusedMapping(t *lintTemplate) []Problem {
+	return unused(t, "Mappings", t.mappings, "mapping", "Fn::FindInMap")
+}
+
+// unused reports the names declared in section that no reference of one
+// of kinds refers to.
+func unused(t *lintTemplate, section string, declared map[string]*yaml.Node, what string, kinds ...string) []Problem {
+	used := make(map[string]bool)
+	for _, r := range t.refs {
+		for _, kind := range kinds {
+			if r.kind == kind {
+				used[r.name] = true
+			}
+		}
+	}
+
+	var problems []Problem
+	for _, name := range t.order[section] {
+		if !used[name] {
+			problems = append(problems, problemAt(declared[name], "%s %s is never used", what, name))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,97 @@
+package cfn
+
+import (
+	"reflect"
+	"testing"
+)
+
+const lintTemplateSource = `Parameters:
+  Env: {Type: String}
+  Unused: {Type: String}
+Mappings:
+  M: {a: {b: c}}
+  Spare: {a: {b: c}}
+Conditions:
+  IsProd: !Equals [!Ref Env, prod]
+  Never: !Equals [a, b]
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Condition: IsProd
+  Queue:
+    Properties:
+      Name: !Sub '${Bucket}-${Missing}-${AWS::Region}'
+      Arn: !GetAtt Nothing.Arn
+      Map: !FindInMap [M, a, b]
+      Other: !FindInMap [Nope, a, b]
+      C: !If [Unknown, 1, 2]
+  Topic:
+    Type: AWS::SNS::Topic
+    DependsOn: [Bucket, Ghost]
+    Properties:
+      Q: !GetAtt Bucket.Arn
+      R: !Ref Bucket
+`
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []string
+	}{
+		{
+			name: "every rule",
+			want: []string{
+				"line 3, column 3: parameter Unused is never used (unused-parameter)",
+				"line 6, column 3: mapping Spare is never used (unused-mapping)",
+				"line 9, column 3: condition Never is never used (unused-condition)",
+				"line 14, column 3: resource Queue has no Type (missing-type)",
+				"line 16, column 13: Fn::Sub refers to Missing, which is not a parameter or resource (undefined-ref)",
+				"line 17, column 12: Fn::GetAtt refers to Nothing, which is not a declared resource (undefined-getatt)",
+				"line 19, column 14: Fn::FindInMap refers to Nope, which is not a declared mapping (undefined-mapping)",
+				"line 20, column 10: Condition refers to Unknown, which is not a declared condition (undefined-condition)",
+				"line 23, column 25: DependsOn refers to Ghost, which is not a declared resource (undefined-dependency)",
+			},
+		},
+		{
+			name:  "named rules",
+			rules: []string{"missing-type", "undefined-dependency"},
+			want: []string{
+				"line 14, column 3: resource Queue has no Type (missing-type)",
+				"line 23, column 25: DependsOn refers to Ghost, which is not a declared resource (undefined-dependency)",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := Lint(parse(t, lintTemplateSource), test.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.String())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := Lint(parse(t, lintTemplateSource), []string{"bogus"}); err == nil || err.Error() != "unknown lint rule bogus" {
+		t.Errorf("got %v, want unknown lint rule bogus", err)
+	}
+}
+
+func TestLintMergedReferences(t *testing.T) {
+	src := "Parameters:\n  Env: {Type: String}\nDefaults: &defaults\n  Name: !Ref Env\n" +
+		"Resources:\n  Bucket:\n    Type: AWS::S3::Bucket\n    Properties:\n      <<: *defaults\n"
+	problems, err := Lint(parse(t, src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("got %v, want no problems", problems)
+	}
+}
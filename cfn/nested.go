@@ -0,0 +1,188 @@
+package cfn
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// A NestedStack is an AWS::CloudFormation::Stack resource whose template
+// is a local file.
+type NestedStack struct {
+	Resource    *yaml.Node
+	Name        string
+	TemplateURL *yaml.Node
+	Parameters  *yaml.Node
+}
+
+// NestedStacks returns the nested stack resources of a template whose
+// TemplateURL refers to a local file.
+func NestedStacks(doc *yaml.Node) []NestedStack {
+	var stacks []NestedStack
+	resources := section(doc, "Resources")
+	for _, name := range keys(resources) {
+		resource := lookup(resources, name)
+		typ := lookup(resource, "Type")
+		if typ == nil || typ.Value != "AWS::CloudFormation::Stack" {
+			continue
+		}
+
+		properties := lookup(resource, "Properties")
+		url := lookup(properties, "TemplateURL")
+		if url == nil || url.Kind != yaml.ScalarNode || url.Tag != "" || !isLocalPath(url.Value) {
+			continue
+		}
+
+		stacks = append(stacks, NestedStack{Name: name, Resource: resource, TemplateURL: url, Parameters: lookup(properties, "Parameters")})
+	}
+	return stacks
+}
+
+// ValidateNestedStacks checks the parameters a template passes to each of
+// its local nested stacks against the child template, with relative paths
+// resolved against dir. It reports parameters passed but not declared by
+// the child, parameters without a default that the child requires but
+// are not passed, and Fn::GetAtt references to Outputs.X of a nested stack
+// whose template does not declare the output X. Merge keys are resolved
+// first, in the template and in each child, so stacks that inherit their
+// properties through << and children that declare their parameters and
+// outputs through << are checked too. Children are parsed in strict mode
+// if strict is set.
+func ValidateNestedStacks(doc *yaml.Node, dir string, strict bool) []error {
+	expanded, err := yaml.Expand(doc)
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	outputs := make(map[string][]string)
+
+	for _, stack := range NestedStacks(expanded) {
+		path := stack.TemplateURL.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			errs = append(errs, nodeErrorf(stack.TemplateURL, "nested-stack", "nested stack %s: %v", stack.Name, err))
+			continue
+		}
+		child, err := yaml.UnmarshalToTree(data, strict)
+		if err == nil {
+			child, err = yaml.Expand(child)
+		}
+		if err != nil {
+			errs = append(errs, nodeErrorf(stack.TemplateURL, "nested-stack", "nested stack %s: %s: %v", stack.Name, path, err))
+			continue
+		}
+
+		declared := section(child, "Parameters")
+		passed := make(map[string]bool)
+
+		pairs(stack.Parameters, func(key, value *yaml.Node) {
+			passed[key.Value] = true
+			if lookup(declared, key.Value) == nil {
+				errs = append(errs, nodeErrorf(key, "nested-parameter", "nested stack %s passes parameter %s which %s does not declare",
+					stack.Name, key.Value, stack.TemplateURL.Value))
+			}
+		})
+
+		for _, name := range keys(declared) {
+			if !passed[name] && lookup(lookup(declared, name), "Default") == nil {
+				errs = append(errs, nodeErrorf(stack.Resource, "nested-parameter", "nested stack %s does not pass parameter %s required by %s",
+					stack.Name, name, stack.TemplateURL.Value))
+			}
+		}
+
+		outputs[stack.Name] = keys(section(child, "Outputs"))
+	}
+
+	walk(expanded, func(n *yaml.Node) {
+		resource, attribute, ok := getAtt(n)
+		if !ok || !strings.HasPrefix(attribute, "Outputs.") {
+			return
+		}
+		declared, ok := outputs[resource]
+		if !ok {
+			return
+		}
+		output := strings.TrimPrefix(attribute, "Outputs.")
+		for _, name := range declared {
+			if name == output {
+				return
+			}
+		}
+		errs = append(errs, nodeErrorf(n, "nested-output", "%s.%s refers to output %s which nested stack %s does not declare",
+			resource, attribute, output, resource))
+	})
+
+	return errs
+}
+
+// NestedStackParameters returns the parameter values that each local
+// nested stack of doc passes to its template, keyed by stack name, given
+// the values of the parameters of doc. Passed values that aren't known
+// before deployment, including those of parameters of doc without a value
+// in values, are given UnknownValue so that they don't take the child's
+// default. Pseudo parameters carry over to the children, except
+// AWS::StackName, since a nested stack has a name of its own.
+func NestedStackParameters(doc *yaml.Node, values map[string]string) (map[string]map[string]string, error) {
+	expanded, err := yaml.Expand(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	e := newEvaluator(expanded, values, false)
+	stacks := make(map[string]map[string]string)
+
+	for _, stack := range NestedStacks(expanded) {
+		passed := make(map[string]string)
+		for k, v := range values {
+			if strings.HasPrefix(k, "AWS::") && k != "AWS::StackName" {
+				passed[k] = v
+			}
+		}
+		pairs(stack.Parameters, func(key, value *yaml.Node) {
+			v, ok := e.literal(value)
+			if !ok {
+				v = UnknownValue
+			}
+			passed[key.Value] = v
+		})
+		stacks[stack.Name] = passed
+	}
+	return stacks, nil
+}
+
+// getAtt returns the resource and attribute of an Fn::GetAtt in either
+// its short or long form.
+func getAtt(n *yaml.Node) (resource string, attribute string, ok bool) {
+	var args *yaml.Node
+	switch {
+	case n.Tag == "!GetAtt":
+		args = n
+	case n.Kind == yaml.MappingNode && len(n.Children) == 2 && n.Children[0].Value == "Fn::GetAtt":
+		args = resolve(n.Children[1])
+	default:
+		return "", "", false
+	}
+
+	if args.Kind == yaml.ScalarNode {
+		parts := strings.SplitN(args.Value, ".", 2)
+		if len(parts) != 2 {
+			return "", "", false
+		}
+		return parts[0], parts[1], true
+	}
+
+	if args.Kind == yaml.SequenceNode && len(args.Children) == 2 {
+		r, a := resolve(args.Children[0]), resolve(args.Children[1])
+		if r.Kind == yaml.ScalarNode && a.Kind == yaml.ScalarNode {
+			return r.Value, a.Value, true
+		}
+	}
+	return "", "", false
+}
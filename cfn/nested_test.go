@@ -0,0 +1,162 @@
+package cfn
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNestedStacks(t *testing.T) {
+	src := `Resources:
+  Local:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: stacks/child.yml
+      Parameters: {Env: prod}
+  Uploaded:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: https://bucket.s3.amazonaws.com/child.yml
+  Computed:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: !Sub '${Bucket}/child.yml'
+  Other:
+    Type: AWS::S3::Bucket
+    Properties:
+      TemplateURL: child.yml
+  Second:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: ./other.yml
+`
+
+	stacks := NestedStacks(parse(t, src))
+	var got []string
+	for _, stack := range stacks {
+		got = append(got, stack.Name+" "+stack.TemplateURL.Value)
+	}
+	want := []string{"Local stacks/child.yml", "Second ./other.yml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if env := lookup(stacks[0].Parameters, "Env"); env == nil || env.Value != "prod" {
+		t.Errorf("got parameter Env %v, want prod", env)
+	}
+}
+
+func TestNestedStackParameters(t *testing.T) {
+	src := `Parameters:
+  Env: {Type: String}
+  Size: {Type: Number, Default: 1}
+Resources:
+  A:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: a.yml
+      Parameters:
+        Env: !Ref Env
+        Name: !Sub '${Env}-${AWS::Region}'
+        Size: !Ref Size
+        Arn: !GetAtt Q.Arn
+  B:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: b.yml
+`
+
+	values := map[string]string{"Env": "prod", "AWS::Region": "us-east-1", "AWS::StackName": "app"}
+	got, err := NestedStackParameters(parse(t, src), values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Size has no value, so the default of the parent isn't passed on
+	want := map[string]map[string]string{
+		"A": {"Env": "prod", "Name": "prod-us-east-1", "Size": UnknownValue, "Arn": UnknownValue, "AWS::Region": "us-east-1"},
+		"B": {"AWS::Region": "us-east-1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestValidateNestedStacks(t *testing.T) {
+	dir := t.TempDir()
+	children := map[string]string{
+		"child.yml": "Parameters:\n  Env: {Type: String}\n  Size: {Type: Number, Default: 1}\nOutputs:\n  Arn: {Value: x}\n",
+		"merged.yml": "Common: &common\n  Env: {Type: String}\nParameters:\n  <<: *common\n  Size: {Type: Number, Default: 1}\n" +
+			"Outputs:\n  <<: {Arn: {Value: x}}\n",
+		"twice.yml": "Parameters:\n  Env: {Type: String}\n  Env: {Type: String}\n",
+	}
+	for name, child := range children {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(child), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		src    string
+		strict bool
+		want   []string
+	}{
+		{
+			name: "valid",
+			src: "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: child.yml\n      Parameters: {Env: prod}\n" +
+				"Outputs:\n  A: {Value: !GetAtt S.Outputs.Arn}\n",
+		},
+		{
+			name: "undeclared parameter",
+			src:  "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: child.yml\n      Parameters: {Env: prod, Other: 1}\n",
+			want: []string{"6:31: nested stack S passes parameter Other which child.yml does not declare [nested-parameter]"},
+		},
+		{
+			name: "missing parameter",
+			src:  "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: child.yml\n",
+			want: []string{"3:5: nested stack S does not pass parameter Env required by child.yml [nested-parameter]"},
+		},
+		{
+			name: "undeclared output",
+			src: "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: child.yml\n      Parameters: {Env: prod}\n" +
+				"Outputs:\n  A: {Value: {Fn::GetAtt: [S, Outputs.Name]}}\n",
+			want: []string{"8:14: S.Outputs.Name refers to output Name which nested stack S does not declare [nested-output]"},
+		},
+		{
+			name: "merged properties",
+			src: "Stack: &stack\n  TemplateURL: child.yml\n" +
+				"Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      <<: *stack\n",
+			want: []string{"5:5: nested stack S does not pass parameter Env required by child.yml [nested-parameter]"},
+		},
+		{
+			name: "merged child",
+			src: "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: merged.yml\n      Parameters: {Env: prod, Size: 2}\n" +
+				"Outputs:\n  A: {Value: !GetAtt S.Outputs.Arn}\n",
+		},
+		{
+			name:   "strict child",
+			src:    "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: twice.yml\n      Parameters: {Env: prod}\n",
+			strict: true,
+			want: []string{"5:20: nested stack S: " + filepath.Join(dir, "twice.yml") +
+				": 3:3: key Env is already defined at line 2, column 3 [duplicate-key] [nested-stack]"},
+		},
+		{
+			name: "missing template",
+			src:  "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: missing.yml\n",
+			want: []string{"5:20: nested stack S: open " + filepath.Join(dir, "missing.yml") + ": no such file or directory [nested-stack]"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, err := range ValidateNestedStacks(parse(t, test.src), dir, test.strict) {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package cfn
+
+import "github.com/ukayani/cloudformation-plus/yaml"
+
+// nodeErrorf returns an error with code at the position of n.
+func nodeErrorf(n *yaml.Node, code string, format string, args ...interface{}) *yaml.Error {
+	return yaml.NewError(n, code, format, args...)
+}
+
+// resolve follows alias nodes to the node they refer to.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// root returns the top level mapping of a document, or nil if the
+// document is empty or not a mapping.
+func root(doc *yaml.Node) *yaml.Node {
+	if doc == nil {
+		return nil
+	}
+	if doc.Kind == yaml.DocumentNode {
+		if len(doc.Children) == 0 {
+			return nil
+		}
+		doc = doc.Children[0]
+	}
+	doc = resolve(doc)
+	if doc == nil || doc.Kind != yaml.MappingNode {
+		return nil
+	}
+	return doc
+}
+
+// lookup returns the value for key in the mapping m, or nil if m is not
+// a mapping or the key is not present.
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	m = resolve(m)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Children); i += 2 {
+		k := resolve(m.Children[i])
+		if k.Kind == yaml.ScalarNode && k.Value == key {
+			return resolve(m.Children[i+1])
+		}
+	}
+	return nil
+}
+
+// section returns the top level section of a template, such as Resources.
+func section(doc *yaml.Node, name string) *yaml.Node {
+	return lookup(root(doc), name)
+}
+
+// keys returns the scalar keys of the mapping m in document order.
+func keys(m *yaml.Node) []string {
+	m = resolve(m)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	var out []string
+	for i := 0; i+1 < len(m.Children); i += 2 {
+		k := resolve(m.Children[i])
+		if k.Kind == yaml.ScalarNode {
+			out = append(out, k.Value)
+		}
+	}
+	return out
+}
+
+// pairs calls fn with each scalar key and its value in the mapping m.
+func pairs(m *yaml.Node, fn func(key, value *yaml.Node)) {
+	m = resolve(m)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(m.Children); i += 2 {
+		k := resolve(m.Children[i])
+		if k.Kind == yaml.ScalarNode {
+			fn(k, resolve(m.Children[i+1]))
+		}
+	}
+}
+
+// walk calls fn for n and every node below it. Aliases are not followed.
+func walk(n *yaml.Node, fn func(n *yaml.Node)) {
+	if n == nil {
+		return
+	}
+	fn(n)
+	if n.Kind == yaml.AliasNode {
+		return
+	}
+	for _, c := range n.Children {
+		walk(c, fn)
+	}
+}
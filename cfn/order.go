@@ -0,0 +1,115 @@
+package cfn
+
+import (
+	"sort"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// SectionOrder is the conventional order of the top level sections of a
+// template.
+var SectionOrder = []string{
+	"AWSTemplateFormatVersion",
+	"Description",
+	"Metadata",
+	"Parameters",
+	"Mappings",
+	"Conditions",
+	"Transform",
+	"Resources",
+	"Outputs",
+}
+
+// AttributeOrder is the conventional order of the attributes of a resource.
+var AttributeOrder = []string{
+	"Type",
+	"Condition",
+	"DependsOn",
+	"Properties",
+	"Metadata",
+	"CreationPolicy",
+	"UpdatePolicy",
+	"UpdateReplacePolicy",
+	"DeletionPolicy",
+}
+
+// CanonicalOrder puts the top level sections of doc in SectionOrder and the
+// attributes of its resources in AttributeOrder. Merge keys come first.
+// Other top level keys, which in cf-plus templates usually hold anchors,
+// come before the sections, and other resource attributes after the known
+// ones. Keys of equal rank keep their order.
+func CanonicalOrder(doc *yaml.Node) {
+	sortPairs(root(doc), func(key string) int {
+		return rank(key, SectionOrder, -1)
+	}, false)
+
+	pairs(section(doc, "Resources"), func(key, value *yaml.Node) {
+		sortPairs(value, func(key string) int {
+			return rank(key, AttributeOrder, len(AttributeOrder))
+		}, false)
+	})
+
+	yaml.MoveAnchorsBeforeAliases(doc)
+}
+
+// SortProperties puts the properties of each resource of doc in
+// alphabetical order, after any merge keys.
+func SortProperties(doc *yaml.Node) {
+	pairs(section(doc, "Resources"), func(key, value *yaml.Node) {
+		sortPairs(lookup(value, "Properties"), func(key string) int {
+			return rank(key, nil, 0)
+		}, true)
+	})
+
+	yaml.MoveAnchorsBeforeAliases(doc)
+}
+
+// rank returns the rank of key in order, or other if it isn't listed.
+// Merge keys rank before everything.
+func rank(key string, order []string, other int) int {
+	if key == "<<" {
+		return -2
+	}
+	for i, k := range order {
+		if k == key {
+			return i
+		}
+	}
+	return other
+}
+
+// sortPairs stably sorts the key and value pairs of the mapping m by the
+// rank of their keys, then alphabetically if byName is set. Keys that
+// aren't scalars rank with the empty key.
+func sortPairs(m *yaml.Node, rankOf func(key string) int, byName bool) {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return
+	}
+
+	type pair struct {
+		key, value *yaml.Node
+		name       string
+		rank       int
+	}
+	ps := make([]pair, 0, len(m.Children)/2)
+	for i := 0; i+1 < len(m.Children); i += 2 {
+		p := pair{key: m.Children[i], value: m.Children[i+1]}
+		if k := resolve(p.key); k.Kind == yaml.ScalarNode {
+			p.name = k.Value
+		}
+		p.rank = rankOf(p.name)
+		ps = append(ps, p)
+	}
+
+	sort.SliceStable(ps, func(i, j int) bool {
+		if ps[i].rank != ps[j].rank {
+			return ps[i].rank < ps[j].rank
+		}
+		return byName && ps[i].name < ps[j].name
+	})
+
+	for i, p := range ps {
+		m.Children[2*i] = p.key
+		m.Children[2*i+1] = p.value
+	}
+}
@@ -0,0 +1,75 @@
+package cfn
+
+import "testing"
+
+func TestCanonicalOrder(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "sections and attributes",
+			src: "Resources:\n  A:\n    Properties: {B: 1, A: 2}\n    DeletionPolicy: Retain\n    Custom: 1\n    Type: T\n" +
+				"Parameters: {}\nanchors:\n  x: &x 1\nDescription: d\n",
+			want: "anchors:\n  x: &x 1\nDescription: d\nParameters: {}\n" +
+				"Resources:\n  A:\n    Type: T\n    Properties: {B: 1, A: 2}\n    DeletionPolicy: Retain\n    Custom: 1\n",
+		},
+		{
+			name: "merge keys first",
+			src:  "Resources:\n  A:\n    Properties: {}\n    <<: {Condition: C}\n    Type: T\n",
+			want: "Resources:\n  A:\n    <<: {Condition: C}\n    Type: T\n    Properties: {}\n",
+		},
+		{
+			// an anchor moved after its alias swaps places with it
+			name: "anchors before aliases",
+			src:  "Outputs:\n  O: &v {Value: 1}\nResources:\n  R: {Type: T, Metadata: *v}\n",
+			want: "Resources:\n  R: {Type: T, Metadata: &v {Value: 1}}\nOutputs:\n  O: *v\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			CanonicalOrder(doc)
+			if got := marshal(t, doc); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSortProperties(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "alphabetical",
+			src:  "Resources:\n  A:\n    Type: T\n    Properties: {B: 1, C: 2, A: 3}\n",
+			want: "Resources:\n  A:\n    Type: T\n    Properties: {A: 3, B: 1, C: 2}\n",
+		},
+		{
+			name: "merge keys first",
+			src:  "Resources:\n  A:\n    Properties:\n      Z: 1\n      <<: {M: 1}\n      B: 2\n",
+			want: "Resources:\n  A:\n    Properties:\n      <<: {M: 1}\n      B: 2\n      Z: 1\n",
+		},
+		{
+			name: "anchors before aliases",
+			src:  "Resources:\n  A:\n    Type: T\n    Properties: {Z: &p 1, A: *p}\n",
+			want: "Resources:\n  A:\n    Type: T\n    Properties: {A: &p 1, Z: *p}\n",
+		},
+		{
+			name: "nested values keep their order",
+			src:  "Resources:\n  A:\n    Properties: {B: {Y: 1, X: 2}, A: [2, 1]}\n",
+			want: "Resources:\n  A:\n    Properties: {A: [2, 1], B: {Y: 1, X: 2}}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			SortProperties(doc)
+			if got := marshal(t, doc); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package cfn
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// An Artifact is the location of an uploaded file.
+type Artifact struct {
+	Bucket string
+	Key    string
+	URL    string
+}
+
+// An Uploader stores packaged artifacts, such as zipped function code or
+// nested stack templates, and reports where they can be fetched from.
+type Uploader interface {
+	Upload(key string, data []byte) (Artifact, error)
+}
+
+// FileUploader is an Uploader that stores artifacts in a local directory.
+// Artifact URLs are formed from BaseURL when set, or are the path of the
+// stored file otherwise. Bucket defaults to the name of Dir.
+type FileUploader struct {
+	Dir     string
+	Bucket  string
+	BaseURL string
+}
+
+func (u *FileUploader) Upload(key string, data []byte) (Artifact, error) {
+	path := filepath.Join(u.Dir, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Artifact{}, err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return Artifact{}, err
+	}
+
+	url := path
+	if u.BaseURL != "" {
+		url = strings.TrimSuffix(u.BaseURL, "/") + "/" + key
+	}
+	bucket := u.Bucket
+	if bucket == "" {
+		bucket = filepath.Base(u.Dir)
+	}
+	return Artifact{Bucket: bucket, Key: key, URL: url}, nil
+}
+
+// artifact forms, describing how an uploaded artifact is written back to
+// the property that referred to it.
+const (
+	urlForm       = iota // https://bucket.s3.amazonaws.com/key
+	s3URIForm            // s3://bucket/key
+	s3CodeForm           // {S3Bucket: bucket, S3Key: key}
+	bucketKeyForm        // {Bucket: bucket, Key: key}
+)
+
+type artifactProperty struct {
+	property string
+	form     int
+	zip      bool // Whether the artifact must be a zip file.
+	template bool // Whether the artifact is a template, packaged in turn.
+}
+
+// artifactProperties lists, by resource type, the properties that may
+// refer to local files to be packaged.
+var artifactProperties = map[string][]artifactProperty{
+	"AWS::CloudFormation::Stack":                {{"TemplateURL", urlForm, false, true}},
+	"AWS::Serverless::Application":              {{"Location", urlForm, false, true}},
+	"AWS::Serverless::Function":                 {{"CodeUri", s3URIForm, true, false}},
+	"AWS::Serverless::LayerVersion":             {{"ContentUri", s3URIForm, true, false}},
+	"AWS::Serverless::Api":                      {{"DefinitionUri", s3URIForm, false, false}},
+	"AWS::Serverless::StateMachine":             {{"DefinitionUri", s3URIForm, false, false}},
+	"AWS::Lambda::Function":                     {{"Code", s3CodeForm, true, false}},
+	"AWS::Lambda::LayerVersion":                 {{"Content", s3CodeForm, true, false}},
+	"AWS::ElasticBeanstalk::ApplicationVersion": {{"SourceBundle", s3CodeForm, true, false}},
+	"AWS::ApiGateway::RestApi":                  {{"BodyS3Location", bucketKeyForm, false, false}},
+	"AWS::StepFunctions::StateMachine":          {{"DefinitionS3Location", bucketKeyForm, false, false}},
+	"AWS::AppSync::GraphQLSchema":               {{"DefinitionS3Location", urlForm, false, false}},
+	"AWS::AppSync::Resolver": {
+		{"RequestMappingTemplateS3Location", urlForm, false, false},
+		{"ResponseMappingTemplateS3Location", urlForm, false, false},
+	},
+}
+
+// A TemplateLoader reads the template at path the way the template that
+// refers to it was read, including its files and resolving its library
+// anchors, so that nested templates can be packaged in turn.
+type TemplateLoader func(path string) (*yaml.Node, error)
+
+// Package uploads the local files and directories referred to by resource
+// properties such as TemplateURL, CodeUri and Code, and rewrites those
+// properties with the location of the uploaded artifact. Directories, and
+// files for properties that require one, are zipped. Artifacts are keyed
+// by the hash of their contents. Relative paths are resolved against dir.
+// Merge keys are resolved first, so properties inherited through << are
+// packaged too, and rewritten where they are defined. Nested templates are
+// read with load and packaged themselves before they are uploaded, with
+// their aliases resolved.
+func Package(doc *yaml.Node, dir string, uploader Uploader, load TemplateLoader) error {
+	return packageTemplate(doc, dir, uploader, load, nil)
+}
+
+// packageTemplate packages doc like Package. parents holds the paths of
+// the nested templates being packaged that lead to doc, to detect cycles.
+func packageTemplate(doc *yaml.Node, dir string, uploader Uploader, load TemplateLoader, parents []string) error {
+	expanded, sources, err := yaml.ExpandWithSources(doc)
+	if err != nil {
+		return err
+	}
+
+	resources := section(expanded, "Resources")
+	for _, name := range keys(resources) {
+		resource := lookup(resources, name)
+		typ := lookup(resource, "Type")
+		properties := lookup(resource, "Properties")
+		if typ == nil || properties == nil {
+			continue
+		}
+
+		for _, p := range artifactProperties[typ.Value] {
+			value := lookup(properties, p.property)
+			if value == nil || value.Kind != yaml.ScalarNode || value.Tag != "" || !isLocalPath(value.Value) {
+				continue
+			}
+
+			path := value.Value
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+
+			var artifact Artifact
+			if p.template {
+				artifact, err = uploadTemplate(filepath.Clean(path), uploader, load, parents)
+			} else {
+				artifact, err = upload(path, p.zip, uploader)
+			}
+			if err != nil {
+				return nodeErrorf(value, "package", "%s.%s: %v", name, p.property, err)
+			}
+
+			sources[value].Replace(artifactNode(artifact, p.form))
+		}
+	}
+	return nil
+}
+
+// isLocalPath reports whether a property value refers to a local file
+// rather than something already uploaded.
+func isLocalPath(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, prefix := range []string{"s3://", "http://", "https://"} {
+		if strings.HasPrefix(value, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func upload(path string, mustZip bool, uploader Uploader) (Artifact, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	var data []byte
+	ext := filepath.Ext(path)
+
+	switch {
+	case info.IsDir():
+		data, err = zipDir(path)
+		ext = ".zip"
+	case mustZip && ext != ".zip" && ext != ".jar":
+		data, err = zipFiles(filepath.Dir(path), []string{filepath.Base(path)})
+		ext = ".zip"
+	default:
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	return uploadData(data, ext, uploader)
+}
+
+// uploadTemplate reads the nested template at path with load, packages
+// its own artifacts and uploads it with its aliases resolved, so that the
+// uploaded copy doesn't depend on anything local.
+func uploadTemplate(path string, uploader Uploader, load TemplateLoader, parents []string) (Artifact, error) {
+	for _, parent := range parents {
+		if parent == path {
+			return Artifact{}, fmt.Errorf("nested templates refer to each other: %s -> %s", strings.Join(parents, " -> "), path)
+		}
+	}
+
+	doc, err := load(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	if err := packageTemplate(doc, filepath.Dir(path), uploader, load, append(parents, path)); err != nil {
+		return Artifact{}, err
+	}
+
+	data, err := yaml.MarshalFromTree(doc, true, true)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return uploadData(data, filepath.Ext(path), uploader)
+}
+
+// uploadData uploads data keyed by its hash and extension ext.
+func uploadData(data []byte, ext string, uploader Uploader) (Artifact, error) {
+	sum := sha256.Sum256(data)
+	return uploader.Upload(hex.EncodeToString(sum[:])+ext, data)
+}
+
+func artifactNode(a Artifact, form int) *yaml.Node {
+	switch form {
+	case s3URIForm:
+		return yaml.NewScalar("s3://"+a.Bucket+"/"+a.Key, "")
+	case s3CodeForm:
+		return yaml.NewMapping(
+			yaml.NewScalar("S3Bucket", ""), yaml.NewScalar(a.Bucket, ""),
+			yaml.NewScalar("S3Key", ""), yaml.NewScalar(a.Key, ""))
+	case bucketKeyForm:
+		return yaml.NewMapping(
+			yaml.NewScalar("Bucket", ""), yaml.NewScalar(a.Bucket, ""),
+			yaml.NewScalar("Key", ""), yaml.NewScalar(a.Key, ""))
+	default:
+		return yaml.NewScalar(a.URL, "")
+	}
+}
+
+func zipDir(dir string) ([]byte, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return zipFiles(dir, files)
+}
+
+// zipFiles zips the named files, relative to dir. Entries are sorted and
+// carry a fixed modification time so that unchanged contents always
+// produce the same archive, and therefore the same artifact key.
+func zipFiles(dir string, files []string) ([]byte, error) {
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return nil, err
+		}
+		header.Name = filepath.ToSlash(name)
+		header.Method = zip.Deflate
+		header.Modified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
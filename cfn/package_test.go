@@ -0,0 +1,221 @@
+package cfn
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// memoryUploader is an Uploader that keeps artifacts in memory.
+type memoryUploader map[string][]byte
+
+func (u memoryUploader) Upload(key string, data []byte) (Artifact, error) {
+	u[key] = data
+	return Artifact{Bucket: "bucket", Key: key, URL: "https://bucket.s3.amazonaws.com/" + key}, nil
+}
+
+// readTemplate is a TemplateLoader that parses the template at path and
+// inlines the files it includes.
+func readTemplate(path string) (*yaml.Node, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := yaml.UnmarshalToTree(data, false)
+	if err != nil {
+		return nil, err
+	}
+	_, err = IncludeFiles(doc, filepath.Dir(path), DefaultMaxIncludeSize)
+	return doc, err
+}
+
+func TestPackage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string]string{
+		"src/index.js": "exports.handler = () => {}\n",
+		"app.jar":      "jar",
+		"child.yml":    "Resources: {}\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		// want holds strings the packaged template must contain, with KEY
+		// standing for the key of an uploaded artifact.
+		want []string
+		keep []string
+		// uploads is the number of artifacts uploaded.
+		uploads int
+	}{
+		{
+			name:    "zipped directory",
+			src:     "Resources:\n  F:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: src\n",
+			want:    []string{"CodeUri: s3://bucket/KEY.zip"},
+			uploads: 1,
+		},
+		{
+			name:    "code mapping",
+			src:     "Resources:\n  F:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: app.jar\n",
+			want:    []string{"S3Bucket: bucket", "S3Key: KEY.jar"},
+			uploads: 1,
+		},
+		{
+			name:    "nested stack url",
+			src:     "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: child.yml\n",
+			want:    []string{"TemplateURL: https://bucket.s3.amazonaws.com/KEY.yml"},
+			uploads: 1,
+		},
+		{
+			name: "already uploaded",
+			src:  "Resources:\n  F:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: s3://other/code.zip\n",
+			keep: []string{"CodeUri: s3://other/code.zip"},
+		},
+		{
+			name: "intrinsic",
+			src:  "Resources:\n  F:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: !Ref Code\n",
+			keep: []string{"CodeUri: !Ref Code"},
+		},
+		{
+			name: "merged property",
+			src: "Defaults: &defaults\n  Code: app.jar\n" +
+				"Resources:\n  F:\n    Type: AWS::Lambda::Function\n    Properties:\n      <<: *defaults\n      Handler: x\n",
+			want:    []string{"Defaults: &defaults\n  Code:\n    S3Bucket: bucket\n    S3Key: KEY.jar\n", "<<: *defaults"},
+			uploads: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			uploads := memoryUploader{}
+			if err := Package(doc, dir, uploads, readTemplate); err != nil {
+				t.Fatal(err)
+			}
+			out := marshal(t, doc)
+
+			if len(uploads) != test.uploads {
+				t.Errorf("uploaded %d artifacts, want %d", len(uploads), test.uploads)
+			}
+
+			for _, want := range test.want {
+				for key := range uploads {
+					want = strings.Replace(want, "KEY"+filepath.Ext(key), key, 1)
+				}
+				if !strings.Contains(out, want) {
+					t.Errorf("got\n%s\nwant it to contain\n%s", out, want)
+				}
+			}
+			for _, keep := range test.keep {
+				if !strings.Contains(out, keep) {
+					t.Errorf("got\n%s\nwant it to keep\n%s", out, keep)
+				}
+			}
+		})
+	}
+}
+
+func TestPackageIsReproducible(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.js"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := "Resources:\n  F:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: index.js\n"
+
+	var keys []string
+	for i := 0; i < 2; i++ {
+		uploads := memoryUploader{}
+		if err := Package(parse(t, src), dir, uploads, readTemplate); err != nil {
+			t.Fatal(err)
+		}
+		for key, data := range uploads {
+			keys = append(keys, key)
+			r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r.File) != 1 || r.File[0].Name != "index.js" {
+				t.Errorf("got zip entries %v, want index.js", r.File)
+			}
+		}
+		// the modification time of the file doesn't change the artifact
+		modified := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, "index.js"), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(keys) != 2 || keys[0] != keys[1] {
+		t.Errorf("got keys %v, want the same key twice", keys)
+	}
+}
+
+func TestPackageMissingFile(t *testing.T) {
+	src := "Resources:\n  F:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: missing\n"
+	err := Package(parse(t, src), t.TempDir(), memoryUploader{}, readTemplate)
+	if err == nil || !strings.Contains(err.Error(), "5:16: F.CodeUri:") {
+		t.Errorf("got %v, want an error at F.CodeUri", err)
+	}
+}
+
+func TestPackageNestedTemplate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "stacks", "code"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string]string{
+		"stacks/code/index.js": "exports.handler = () => {}\n",
+		"stacks/notes.txt":     "notes",
+		"stacks/app.yml": "Function: &function\n  Type: AWS::Serverless::Function\n  Properties:\n    CodeUri: code\n" +
+			"Resources:\n  F: *function\n  N: {Type: T, Properties: {Text: !File notes.txt}}\n",
+		"stacks/loop.yml": "Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: loop.yml}}\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the child's own artifacts are packaged, relative to the child
+	src := "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: stacks/app.yml\n"
+	uploads := memoryUploader{}
+	if err := Package(parse(t, src), dir, uploads, readTemplate); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 2 {
+		t.Fatalf("uploaded %d artifacts, want the code and the child template", len(uploads))
+	}
+
+	var code, child string
+	for key, data := range uploads {
+		switch filepath.Ext(key) {
+		case ".zip":
+			code = key
+		case ".yml":
+			child = string(data)
+		}
+	}
+	want := "Function:\n  Type: AWS::Serverless::Function\n  Properties:\n    CodeUri: s3://bucket/" + code + "\n" +
+		"Resources:\n  F:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: s3://bucket/" + code + "\n" +
+		"  N:\n    Type: T\n    Properties:\n      Text: |-\n        notes\n"
+	if child != want {
+		t.Errorf("uploaded child\n%s\nwant\n%s", child, want)
+	}
+
+	src = "Resources:\n  S:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: stacks/loop.yml\n"
+	err := Package(parse(t, src), dir, memoryUploader{}, readTemplate)
+	if err == nil || !strings.Contains(err.Error(), "nested templates refer to each other") {
+		t.Errorf("got %v, want a cycle", err)
+	}
+}
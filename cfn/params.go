@@ -0,0 +1,297 @@
+package cfn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// A Parameter is a template parameter and its constraints.
+type Parameter struct {
+	Name           string
+	Type           string
+	Default        *string
+	AllowedValues  []string
+	AllowedPattern string
+	MinLength      *int
+	MaxLength      *int
+	MinValue       *float64
+	MaxValue       *float64
+	Node           *yaml.Node
+}
+
+// TemplateParameters returns the parameters declared by a template, in
+// the order they are declared. Every invalid constraint is reported
+// together as a yaml.ErrorList.
+func TemplateParameters(doc *yaml.Node) ([]Parameter, error) {
+	var params []Parameter
+	var errs yaml.ErrorList
+
+	pairs(section(doc, "Parameters"), func(key, value *yaml.Node) {
+		p := Parameter{Name: key.Value, Node: key}
+
+		if t := lookup(value, "Type"); t != nil {
+			p.Type = t.Value
+		}
+		if d := lookup(value, "Default"); d != nil {
+			p.Default = &d.Value
+		}
+		if v := lookup(value, "AllowedValues"); v != nil {
+			for _, c := range v.Children {
+				p.AllowedValues = append(p.AllowedValues, resolve(c).Value)
+			}
+		}
+		if v := lookup(value, "AllowedPattern"); v != nil {
+			p.AllowedPattern = v.Value
+		}
+
+		intConstraint := func(name string) *int {
+			v := lookup(value, name)
+			if v == nil {
+				return nil
+			}
+			i, err := strconv.Atoi(v.Value)
+			if err != nil {
+				errs = append(errs, nodeErrorf(v, "invalid-parameter", "parameter %s: %s must be an integer", p.Name, name))
+			}
+			return &i
+		}
+
+		floatConstraint := func(name string) *float64 {
+			v := lookup(value, name)
+			if v == nil {
+				return nil
+			}
+			f, err := strconv.ParseFloat(v.Value, 64)
+			if err != nil {
+				errs = append(errs, nodeErrorf(v, "invalid-parameter", "parameter %s: %s must be a number", p.Name, name))
+			}
+			return &f
+		}
+
+		p.MinLength = intConstraint("MinLength")
+		p.MaxLength = intConstraint("MaxLength")
+		p.MinValue = floatConstraint("MinValue")
+		p.MaxValue = floatConstraint("MaxValue")
+
+		params = append(params, p)
+	})
+
+	if len(errs) > 0 {
+		return params, errs
+	}
+	return params, nil
+}
+
+// UnknownValue is the value of a parameter whose value is only known at
+// deployment, such as one that keeps its previous value. Evaluating a
+// template treats such a parameter as unknown rather than giving it its
+// default, and checking parameters accepts it.
+const UnknownValue = "\x00unknown"
+
+// ReadParameters reads parameter values from either the JSON format used
+// by the AWS CLI, a list of ParameterKey and ParameterValue pairs, or the
+// template configuration format used by CodePipeline, an object with a
+// Parameters object of keys and values. Parameters that use their previous
+// value are given UnknownValue.
+func ReadParameters(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var list []struct {
+			ParameterKey     string
+			ParameterValue   string
+			UsePreviousValue bool
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			values[p.ParameterKey] = p.ParameterValue
+			if p.UsePreviousValue {
+				values[p.ParameterKey] = UnknownValue
+			}
+		}
+		return values, nil
+	}
+
+	var config struct {
+		Parameters map[string]string
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for k, v := range config.Parameters {
+		values[k] = v
+	}
+	return values, nil
+}
+
+// CLIParameters returns a skeleton parameters file for params in the JSON
+// format used by the AWS CLI. Values are the parameter defaults.
+func CLIParameters(params []Parameter) ([]byte, error) {
+	type parameter struct {
+		ParameterKey   string
+		ParameterValue string
+	}
+
+	list := []parameter{}
+	for _, p := range params {
+		list = append(list, parameter{ParameterKey: p.Name, ParameterValue: defaultValue(p)})
+	}
+	return marshalJSON(list)
+}
+
+// CodePipelineParameters returns a skeleton template configuration file
+// for params in the format used by CodePipeline. Values are the parameter
+// defaults.
+func CodePipelineParameters(params []Parameter) ([]byte, error) {
+	values := make(map[string]string)
+	for _, p := range params {
+		values[p.Name] = defaultValue(p)
+	}
+	return marshalJSON(struct{ Parameters map[string]string }{values})
+}
+
+func defaultValue(p Parameter) string {
+	if p.Default == nil {
+		return ""
+	}
+	return *p.Default
+}
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// ValidateParameters checks values against the declared params, reporting
+// values for undeclared parameters, missing values for parameters without
+// a default, and values that don't satisfy a parameter's type or
+// constraints. Values that are only known at deployment aren't checked.
+func ValidateParameters(params []Parameter, values map[string]string) []error {
+	var errs []error
+
+	declared := make(map[string]bool)
+	for _, p := range params {
+		declared[p.Name] = true
+
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Default == nil {
+				errs = append(errs, fmt.Errorf("parameter %s requires a value", p.Name))
+			}
+			continue
+		}
+		if value == UnknownValue {
+			continue
+		}
+
+		for _, err := range p.validate(value) {
+			errs = append(errs, fmt.Errorf("parameter %s: %v", p.Name, err))
+		}
+	}
+
+	var undeclared []string
+	for name := range values {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		errs = append(errs, fmt.Errorf("parameter %s is not declared by the template", name))
+	}
+
+	return errs
+}
+
+// validate checks value against the type and constraints of p. The
+// elements of list values are checked one by one.
+func (p Parameter) validate(value string) []error {
+	var errs []error
+
+	var pattern *regexp.Regexp
+	if p.AllowedPattern != "" {
+		var err error
+		pattern, err = regexp.Compile("^(?:" + p.AllowedPattern + ")$")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid AllowedPattern: %v", err))
+		}
+	}
+
+	elements := []string{value}
+	if p.Type == "CommaDelimitedList" || strings.HasPrefix(p.Type, "List<") {
+		elements = strings.Split(value, ",")
+		for i := range elements {
+			elements[i] = strings.TrimSpace(elements[i])
+		}
+	}
+
+	for _, e := range elements {
+		errs = append(errs, p.validateElement(e, pattern)...)
+	}
+	return errs
+}
+
+// validateElement checks a single value, or a single element of a list
+// value, against the type and constraints of p.
+func (p Parameter) validateElement(value string, pattern *regexp.Regexp) []error {
+	var errs []error
+
+	numeric := p.Type == "Number" || p.Type == "List<Number>"
+	if numeric && !isNumber(value) {
+		errs = append(errs, fmt.Errorf("%q is not a number", value))
+	}
+
+	if len(p.AllowedValues) > 0 {
+		allowed := false
+		for _, v := range p.AllowedValues {
+			if v == value {
+				allowed = true
+			}
+		}
+		if !allowed {
+			errs = append(errs, fmt.Errorf("%q is not one of the allowed values [%s]", value, strings.Join(p.AllowedValues, ", ")))
+		}
+	}
+
+	if pattern != nil && !pattern.MatchString(value) {
+		errs = append(errs, fmt.Errorf("%q does not match the pattern %s", value, p.AllowedPattern))
+	}
+
+	if p.MinLength != nil && utf8.RuneCountInString(value) < *p.MinLength {
+		errs = append(errs, fmt.Errorf("%q is shorter than the minimum length of %d", value, *p.MinLength))
+	}
+	if p.MaxLength != nil && utf8.RuneCountInString(value) > *p.MaxLength {
+		errs = append(errs, fmt.Errorf("%q is longer than the maximum length of %d", value, *p.MaxLength))
+	}
+
+	if numeric && isNumber(value) {
+		n, _ := strconv.ParseFloat(value, 64)
+		if p.MinValue != nil && n < *p.MinValue {
+			errs = append(errs, fmt.Errorf("%s is less than the minimum value of %v", value, *p.MinValue))
+		}
+		if p.MaxValue != nil && n > *p.MaxValue {
+			errs = append(errs, fmt.Errorf("%s is greater than the maximum value of %v", value, *p.MaxValue))
+		}
+	}
+
+	return errs
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
@@ -0,0 +1,226 @@
+package cfn
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+func TestTemplateParameters(t *testing.T) {
+	src := `Parameters:
+  Env:
+    Type: String
+    Default: dev
+    AllowedValues: [dev, prod]
+  Size:
+    Type: Number
+    MinValue: 1
+    MaxValue: 10
+  Name:
+    Type: String
+    MinLength: one
+`
+	params, err := TemplateParameters(parse(t, src))
+	errs, ok := err.(yaml.ErrorList)
+	if !ok || len(errs) != 1 || errs[0].Error() != "12:16: parameter Name: MinLength must be an integer [invalid-parameter]" {
+		t.Errorf("got error %v, want an invalid MinLength", err)
+	}
+
+	if len(params) != 3 {
+		t.Fatalf("got %d parameters, want 3", len(params))
+	}
+	env, size := params[0], params[1]
+	if env.Name != "Env" || env.Default == nil || *env.Default != "dev" || !reflect.DeepEqual(env.AllowedValues, []string{"dev", "prod"}) {
+		t.Errorf("got %+v, want Env with default dev and allowed values dev and prod", env)
+	}
+	if size.Type != "Number" || size.MinValue == nil || *size.MinValue != 1 || size.MaxValue == nil || *size.MaxValue != 10 {
+		t.Errorf("got %+v, want Size between 1 and 10", size)
+	}
+}
+
+func TestReadParameters(t *testing.T) {
+	tests := []struct {
+		name, data string
+	}{
+		{"cli", `[{"ParameterKey": "Env", "ParameterValue": "prod"}, {"ParameterKey": "Size", "ParameterValue": "2"}]`},
+		{"codepipeline", `{"Parameters": {"Env": "prod", "Size": "2"}}`},
+	}
+	want := map[string]string{"Env": "prod", "Size": "2"}
+
+	for _, test := range tests {
+		got, err := ReadParameters([]byte(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, want)
+		}
+	}
+
+	previous, err := ReadParameters([]byte(`[{"ParameterKey": "Env", "UsePreviousValue": true}]`))
+	if err != nil || previous["Env"] != UnknownValue {
+		t.Errorf("got %q (%v), want Env to be unknown", previous, err)
+	}
+
+	if _, err := ReadParameters([]byte("Env=prod")); err == nil {
+		t.Error("got no error for an unknown format")
+	}
+}
+
+func TestParameterSkeletons(t *testing.T) {
+	params, err := TemplateParameters(parse(t, "Parameters:\n  Env: {Type: String, Default: dev}\n  Size: {Type: Number}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := CLIParameters(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "ParameterKey": "Env",
+    "ParameterValue": "dev"
+  },
+  {
+    "ParameterKey": "Size",
+    "ParameterValue": ""
+  }
+]
+`
+	if string(cli) != want {
+		t.Errorf("got %s, want %s", cli, want)
+	}
+
+	pipeline, err := CodePipelineParameters(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{
+  "Parameters": {
+    "Env": "dev",
+    "Size": ""
+  }
+}
+`
+	if string(pipeline) != want {
+		t.Errorf("got %s, want %s", pipeline, want)
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	src := `Parameters:
+  Env:
+    Type: String
+    AllowedValues: [dev, prod]
+  Size:
+    Type: Number
+    Default: 1
+    MinValue: 1
+    MaxValue: 10
+  Name:
+    Type: String
+    Default: app
+    AllowedPattern: '[a-z]+'
+    MinLength: 2
+    MaxLength: 5
+  Ports:
+    Type: List<Number>
+    Default: '80'
+    MinValue: 1
+    MaxValue: 1024
+  Zones:
+    Type: CommaDelimitedList
+    Default: a
+    AllowedValues: [a, b]
+  Title:
+    Type: String
+    Default: app
+    MaxLength: 5
+`
+	params, err := TemplateParameters(parse(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   []string
+	}{
+		{
+			name:   "valid",
+			values: map[string]string{"Env": "prod", "Size": "10", "Name": "web", "Ports": "80, 443", "Zones": "a,b"},
+		},
+		{
+			name:   "missing and undeclared",
+			values: map[string]string{"Other": "x", "Another": "y"},
+			want: []string{
+				"parameter Env requires a value",
+				"parameter Another is not declared by the template",
+				"parameter Other is not declared by the template",
+			},
+		},
+		{
+			name:   "allowed values",
+			values: map[string]string{"Env": "test"},
+			want:   []string{`parameter Env: "test" is not one of the allowed values [dev, prod]`},
+		},
+		{
+			name:   "number",
+			values: map[string]string{"Env": "dev", "Size": "big"},
+			want:   []string{`parameter Size: "big" is not a number`},
+		},
+		{
+			name:   "number range",
+			values: map[string]string{"Env": "dev", "Size": "11"},
+			want:   []string{"parameter Size: 11 is greater than the maximum value of 10"},
+		},
+		{
+			name:   "pattern and length",
+			values: map[string]string{"Env": "dev", "Name": "Website"},
+			want: []string{
+				`parameter Name: "Website" does not match the pattern [a-z]+`,
+				`parameter Name: "Website" is longer than the maximum length of 5`,
+			},
+		},
+		{
+			// lengths count characters, not bytes
+			name:   "multibyte length",
+			values: map[string]string{"Env": "dev", "Title": "été", "Name": "évité"},
+			want:   []string{`parameter Name: "évité" does not match the pattern [a-z]+`},
+		},
+		{
+			name:   "previous value",
+			values: map[string]string{"Env": UnknownValue, "Size": UnknownValue},
+		},
+		{
+			name:   "list elements",
+			values: map[string]string{"Env": "dev", "Ports": "80, 0, 8080, http"},
+			want: []string{
+				"parameter Ports: 0 is less than the minimum value of 1",
+				"parameter Ports: 8080 is greater than the maximum value of 1024",
+				`parameter Ports: "http" is not a number`,
+			},
+		},
+		{
+			name:   "list allowed values",
+			values: map[string]string{"Env": "dev", "Zones": "a, c"},
+			want:   []string{`parameter Zones: "c" is not one of the allowed values [a, b]`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, err := range ValidateParameters(params, test.values) {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package cfn
+
+import (
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// A reference is a use of a logical name: a parameter, resource,
+// condition or mapping.
+type reference struct {
+	// kind is Ref, Fn::GetAtt, Fn::Sub, Fn::FindInMap, Condition or
+	// DependsOn.
+	kind string
+	name string
+	at   *yaml.Node
+}
+
+// references returns the references made by intrinsic functions in n and
+// the nodes below it, in document order. Aliases are not followed.
+func references(n *yaml.Node) []reference {
+	var refs []reference
+
+	walk(n, func(n *yaml.Node) {
+		name, args, ok := function(n)
+		if !ok {
+			return
+		}
+
+		switch name {
+		case "Ref":
+			if args.Kind == yaml.ScalarNode {
+				refs = append(refs, reference{name, args.Value, n})
+			}
+		case "Fn::GetAtt":
+			if resource, _, ok := getAtt(n); ok {
+				refs = append(refs, reference{name, resource, n})
+			}
+		case "Fn::Sub":
+			for _, variable := range subReferences(args) {
+				refs = append(refs, reference{name, variable, n})
+			}
+		case "Fn::FindInMap":
+			if args.Kind == yaml.SequenceNode && len(args.Children) > 0 {
+				if m := resolve(args.Children[0]); m.Kind == yaml.ScalarNode && m.Tag == "" {
+					refs = append(refs, reference{name, m.Value, n})
+				}
+			}
+		case "Condition":
+			if args.Kind == yaml.ScalarNode {
+				refs = append(refs, reference{name, args.Value, n})
+			}
+		case "Fn::If":
+			if args.Kind == yaml.SequenceNode && len(args.Children) > 0 {
+				if c := resolve(args.Children[0]); c.Kind == yaml.ScalarNode {
+					refs = append(refs, reference{"Condition", c.Value, n})
+				}
+			}
+		}
+	})
+
+	return refs
+}
+
+// subReferences returns the names referred to by the variables of an
+// Fn::Sub, leaving out those given values by the Fn::Sub itself. The
+// resource of ${Resource.Attribute} is returned.
+func subReferences(args *yaml.Node) []string {
+	var template string
+	local := make(map[string]bool)
+
+	switch {
+	case args.Kind == yaml.ScalarNode:
+		template = args.Value
+	case args.Kind == yaml.SequenceNode && len(args.Children) == 2:
+		t := resolve(args.Children[0])
+		if t.Kind != yaml.ScalarNode {
+			return nil
+		}
+		template = t.Value
+		for _, key := range keys(args.Children[1]) {
+			local[key] = true
+		}
+	default:
+		return nil
+	}
+
+	var names []string
+	for _, match := range subVariable.FindAllStringSubmatch(template, -1) {
+		name := strings.TrimSpace(match[1])
+		if strings.HasPrefix(name, "!") || local[name] {
+			continue
+		}
+		if !strings.HasPrefix(name, "AWS::") {
+			name = strings.SplitN(name, ".", 2)[0]
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// attributeReferences returns the references made by the Condition and
+// DependsOn attributes of a resource or output.
+func attributeReferences(entry *yaml.Node) []reference {
+	var refs []reference
+
+	if c := lookup(entry, "Condition"); c != nil && c.Kind == yaml.ScalarNode {
+		refs = append(refs, reference{"Condition", c.Value, c})
+	}
+
+	dependsOn := lookup(entry, "DependsOn")
+	switch {
+	case dependsOn == nil:
+	case dependsOn.Kind == yaml.ScalarNode:
+		refs = append(refs, reference{"DependsOn", dependsOn.Value, dependsOn})
+	case dependsOn.Kind == yaml.SequenceNode:
+		for _, d := range dependsOn.Children {
+			if d = resolve(d); d.Kind == yaml.ScalarNode {
+				refs = append(refs, reference{"DependsOn", d.Value, d})
+			}
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// configName is the name of the configuration file looked for in the
+// working directory and each of its parents.
+const configName = ".cfplus.yml"
+
+// config is the contents of a configuration file. Its settings are the
+// defaults of the flags of the same name, and relative paths in it are
+// relative to the directory of the file.
+type config struct {
+	// Inputs are the templates, directories or glob patterns built when
+	// none are given.
+	Inputs    []string `yaml:"inputs"`
+	Output    string   `yaml:"output"`
+	Libraries []string `yaml:"libraries"`
+
+	Transforms struct {
+		ResolveAliases     *bool `yaml:"resolve-aliases"`
+		Nested             *bool `yaml:"nested"`
+		ValidateNested     *bool `yaml:"validate-nested"`
+		EvaluateConditions *bool `yaml:"evaluate-conditions"`
+		ResolveIntrinsics  *bool `yaml:"resolve-intrinsics"`
+	} `yaml:"transforms"`
+
+	Format struct {
+		KeepStyle      *bool  `yaml:"keep-style"`
+		Intrinsics     string `yaml:"intrinsics"`
+		CanonicalOrder *bool  `yaml:"canonical-order"`
+		SortProperties *bool  `yaml:"sort-properties"`
+	} `yaml:"format"`
+
+	Limits         string `yaml:"limits"`
+	MaxIncludeSize *int64 `yaml:"max-include-size"`
+	MaxNodes       *int   `yaml:"max-nodes"`
+	MaxDepth       *int   `yaml:"max-depth"`
+	MaxOutputSize  *int64 `yaml:"max-output-size"`
+	Strict         *bool  `yaml:"strict"`
+
+	// Lint holds the rules checked by lint.
+	Lint []string `yaml:"lint"`
+
+	// Environments holds the settings selected with --env.
+	Environments map[string]environment `yaml:"environments"`
+
+	dir string
+}
+
+// environment holds the values a template is evaluated with in one
+// environment.
+type environment struct {
+	Parameters string `yaml:"parameters"`
+	Region     string `yaml:"region"`
+	AccountID  string `yaml:"account-id"`
+	StackName  string `yaml:"stack-name"`
+}
+
+// configOptions selects the configuration file and environment to use.
+type configOptions struct {
+	path string
+	env  string
+}
+
+// register defines the flags that set o on flags.
+func (o *configOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.path, "config", "", "Configuration file to use instead of the "+configName+" found in the working directory or its parents")
+	flags.StringVar(&o.env, "env", "", "Environment of the configuration file to take parameters and pseudo parameters from")
+}
+
+// apply sets the flags in flags that weren't given on the command line
+// from the configuration file, if one is found, and returns the file.
+func (o *configOptions) apply(flags *flag.FlagSet) (*config, error) {
+	path := o.path
+	if path == "" {
+		var err error
+		if path, err = findConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	if path == "" {
+		if o.env != "" {
+			return nil, fmt.Errorf("--env %s: no %s found", o.env, configName)
+		}
+		return nil, nil
+	}
+
+	c, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := c.settings(o.env)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for name, values := range settings {
+		if given[name] || flags.Lookup(name) == nil {
+			continue
+		}
+		for _, value := range values {
+			if err := flags.Set(name, value); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, name, err)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// findConfig returns the path of the configuration file in the working
+// directory or the nearest of its parents, or "" if there is none.
+func findConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		path := filepath.Join(dir, configName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func readConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	c.dir = filepath.Dir(path)
+	return &c, nil
+}
+
+// inputs returns the inputs of the configuration file.
+func (c *config) inputs() []string {
+	inputs := make([]string, len(c.Inputs))
+	for i, input := range c.Inputs {
+		inputs[i] = c.path(input)
+	}
+	return inputs
+}
+
+// path resolves p against the directory of the configuration file.
+func (c *config) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.dir, p)
+}
+
+// settings returns the values of the flags set by the configuration file,
+// including those of the environment env.
+func (c *config) settings(env string) (map[string][]string, error) {
+	settings := make(map[string][]string)
+
+	set := func(name string, value string) {
+		if value != "" {
+			settings[name] = []string{value}
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			set(name, strconv.FormatBool(*value))
+		}
+	}
+
+	set("o", c.path(c.Output))
+	for _, library := range c.Libraries {
+		settings["library"] = append(settings["library"], c.path(library))
+	}
+
+	setBool("resolve-aliases", c.Transforms.ResolveAliases)
+	setBool("nested", c.Transforms.Nested)
+	setBool("validate-nested", c.Transforms.ValidateNested)
+	setBool("evaluate-conditions", c.Transforms.EvaluateConditions)
+	setBool("resolve-intrinsics", c.Transforms.ResolveIntrinsics)
+
+	setBool("keep-style", c.Format.KeepStyle)
+	set("intrinsics", c.Format.Intrinsics)
+	setBool("canonical-order", c.Format.CanonicalOrder)
+	setBool("sort-properties", c.Format.SortProperties)
+
+	set("limits", c.Limits)
+	if c.MaxIncludeSize != nil {
+		set("max-include-size", strconv.FormatInt(*c.MaxIncludeSize, 10))
+	}
+	if c.MaxNodes != nil {
+		set("max-nodes", strconv.Itoa(*c.MaxNodes))
+	}
+	if c.MaxDepth != nil {
+		set("max-depth", strconv.Itoa(*c.MaxDepth))
+	}
+	if c.MaxOutputSize != nil {
+		set("max-output-size", strconv.FormatInt(*c.MaxOutputSize, 10))
+	}
+	setBool("strict", c.Strict)
+
+	set("rules", strings.Join(c.Lint, ","))
+
+	if env != "" {
+		e, ok := c.Environments[env]
+		if !ok {
+			return nil, fmt.Errorf("no environment %s", env)
+		}
+		set("parameters", c.path(e.Parameters))
+		set("region", e.Region)
+		set("account-id", e.AccountID)
+		set("stack-name", e.StackName)
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// dedupeCommand replaces the repeated subtrees of a template with an anchor
+// on their first occurrence and aliases to it everywhere else.
+func dedupeCommand(args []string) {
+	flags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	var minSize = flags.Int("min-size", 10, "Fewest nodes (keys, values and list items) a repeated subtree must have to be replaced")
+	var list = flags.Bool("l", false, "List the repeated subtrees and the anchor names suggested for them instead of replacing them")
+	var write = flags.Bool("w", false, "Overwrite the source instead of writing to dest. Comments are not kept")
+	var keepStyle = flags.Bool("keep-style", false, "Keep YAML style from the source instead of normalizing it")
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "dedupe [options] [source] [dest]",
+		"source and dest default to stdin and stdout")
+
+	flags.Parse(args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	source := flags.Arg(0)
+	if source == "" {
+		source = stdinPath
+	}
+	dest := flags.Arg(1)
+	if dest == stdinPath {
+		dest = ""
+	}
+
+	if flags.NArg() > 2 || *minSize < 1 || (*write && (source == stdinPath || dest != "")) {
+		exitWithUsage(flags)
+	}
+
+	node, err := parseSource(source, false, nil)
+
+	failf(err)
+
+	duplicates := yaml.FindDuplicates(node, *minSize)
+
+	if *list {
+		for _, d := range duplicates {
+			lines := make([]string, len(d.Nodes))
+			for i, n := range d.Nodes {
+				lines[i] = fmt.Sprint(n.Line())
+			}
+			fmt.Printf("&%s: %d nodes repeated %d times, at lines %s\n", d.Anchor, d.Size, len(d.Nodes), strings.Join(lines, ", "))
+		}
+		return
+	}
+
+	yaml.ExtractDuplicates(node, duplicates)
+
+	out, err := yaml.MarshalFromTree(node, false, !*keepStyle)
+
+	failf(pathError(source, err))
+
+	if *write {
+		failf(rewriteSource(source, out))
+		return
+	}
+
+	failf(writeOutput(out, dest))
+}
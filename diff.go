@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+)
+
+// diffCommand reports the semantic differences between two templates.
+// Like diff(1), it exits with 1 when the templates differ and 2 when it
+// fails.
+func diffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	var format = flags.String("format", "text", "Output format: text or json")
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "diff [options] <old> <new>",
+		"exits with 1 if the templates differ and 2 if it fails")
+
+	flags.Parse(args)
+
+	fail := func(err error) {
+		failWith(err, exitTrouble)
+	}
+
+	_, err := configOpts.apply(flags)
+
+	fail(err)
+
+	if flags.NArg() != 2 || (*format != "text" && *format != "json") {
+		exitWithUsage(flags)
+	}
+
+	a, err := loadTemplate(flags.Arg(0), &load)
+
+	fail(err)
+
+	b, err := loadTemplate(flags.Arg(1), &load)
+
+	fail(err)
+
+	changes, err := cfn.Diff(a, b)
+
+	fail(err)
+
+	if *format == "json" {
+		if changes == nil {
+			changes = []cfn.Change{}
+		}
+		out, err := json.MarshalIndent(changes, "", "  ")
+
+		fail(err)
+
+		fmt.Println(string(out))
+	} else {
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+
+	if len(changes) > 0 {
+		os.Exit(exitDiffer)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// explainCommand prints a single subtree of a template fully expanded,
+// annotated with where each key came from.
+func explainCommand(args []string) {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "explain [options] <source> <path>",
+		"path is a dot separated list of keys or indexes, e.g. Resources.Broker2")
+
+	flags.Parse(args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if flags.NArg() != 2 {
+		exitWithUsage(flags)
+	}
+
+	node, err := loadTemplate(flags.Arg(0), &load)
+
+	failf(err)
+
+	out, err := yaml.Explain(node, flags.Arg(1))
+
+	failf(pathError(flags.Arg(0), err))
+
+	fmt.Print(string(out))
+}
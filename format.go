@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// fmtCommand prints templates in normalized form, or like --write and
+// --check rewrites them or lists those that aren't normalized.
+func fmtCommand(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	var opts buildOptions
+	flags.BoolVar(&opts.write, "w", false, "Overwrite each source with its normalized form instead of printing it. Comments are not kept")
+	flags.BoolVar(&opts.check, "l", false, "List the sources whose normalized form differs from their contents instead of printing them")
+	opts.registerFormat(flags)
+	opts.load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+	var jobs = flags.Int("j", runtime.NumCPU(), "Number of templates to format in parallel")
+
+	flags.Usage = usage(flags, "fmt [options] [source or glob]...",
+		"source defaults to stdin",
+		"with -l, exits with 1 if any source isn't normalized")
+
+	patterns := parseInterspersed(flags, args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if (opts.intrinsics != "" && opts.intrinsics != "short" && opts.intrinsics != "long") || *jobs < 1 {
+		exitWithUsage(flags)
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{stdinPath}
+	}
+
+	inputs, err := expandInputs(patterns, "")
+
+	failf(err)
+
+	formatInputs(inputs, &opts, *jobs)
+}
+
+// formatInputs compares each input with its normalized form, overwriting
+// it with that form if opts.write is set and listing it on stdout if
+// opts.check is set. With opts.check, it exits with 1 if any input isn't
+// normalized. With neither, the normalized forms are printed.
+func formatInputs(inputs []input, opts *buildOptions, workers int) {
+	libraries, _, err := loadLibraries(&opts.load)
+
+	failf(err)
+
+	outputs := make([][]byte, len(inputs))
+	changed := make([]bool, len(inputs))
+
+	errs := parallel(len(inputs), workers, func(i int) error {
+		var err error
+		outputs[i], changed[i], err = formatFile(inputs[i].path, opts, libraries)
+		return err
+	})
+
+	differ := false
+	for i, in := range inputs {
+		if errs[i] != nil {
+			continue
+		}
+		if !opts.write && !opts.check {
+			os.Stdout.Write(outputs[i])
+		}
+		if changed[i] {
+			differ = true
+			if opts.check {
+				fmt.Println(in.path)
+			}
+		}
+	}
+
+	exitOnFailures(errs)
+
+	if opts.check && differ {
+		os.Exit(exitFailure)
+	}
+}
+
+// formatFile returns the normalized form of the template at path and
+// whether it differs from its contents, and writes that form back if
+// opts.write is set. Only the options that change the form of a template
+// apply: files aren't included and aliases are kept, including those to
+// the anchors of libraries, so the source stays a source.
+func formatFile(path string, opts *buildOptions, libraries []*yaml.Node) ([]byte, bool, error) {
+	if path == stdinPath && (opts.write || opts.check) {
+		return nil, false, fmt.Errorf("--write and --check need source files, not stdin")
+	}
+
+	data, err := readSource(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	node, err := yaml.UnmarshalWithLibraries(data, opts.load.strict, libraries)
+	if err != nil {
+		return nil, false, pathError(path, err)
+	}
+
+	normalize(node, opts)
+
+	out, err := yaml.MarshalSource(node, true)
+	if err != nil {
+		return nil, false, pathError(path, err)
+	}
+
+	if bytes.Equal(out, data) {
+		return out, false, nil
+	}
+
+	if opts.write {
+		if err := rewriteSource(path, out); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return out, true, nil
+}
+
+// rewriteSource replaces the contents of the file at path with out,
+// keeping its mode.
+func rewriteSource(path string, out []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, info.Mode())
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"lib.yml":    "tags: &tags [{Key: a, Value: b}]\n",
+		"uses.yml":   "R: {Type: T, Tags: *tags}\n",
+		"normal.yml": "R:\n  Type: T\n  Tags: *tags\n",
+	})
+
+	var opts buildOptions
+	opts.load.libraries = stringList{filepath.Join(dir, "lib.yml")}
+	libraries, _, err := loadLibraries(&opts.load)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		changed bool
+	}{
+		{"uses.yml", "R:\n  Type: T\n  Tags: *tags\n", true},
+		{"normal.yml", "R:\n  Type: T\n  Tags: *tags\n", false},
+	}
+
+	for _, test := range tests {
+		out, changed, err := formatFile(filepath.Join(dir, test.name), &opts, libraries)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(out) != test.want || changed != test.changed {
+			t.Errorf("%s: got %q, changed %v, want %q, changed %v", test.name, out, changed, test.want, test.changed)
+		}
+	}
+
+	// without the library, the alias refers to nothing
+	if _, _, err := formatFile(filepath.Join(dir, "uses.yml"), &opts, nil); err == nil {
+		t.Error("got no error for an alias to an unknown anchor")
+	}
+}
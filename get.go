@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// getCommand prints the value at a path of a template with its aliases and
+// merge keys resolved: the value itself for a scalar, or YAML otherwise.
+func getCommand(args []string) {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "get [options] <source> <path>",
+		"path is a dot separated list of keys or indexes, e.g. Resources.Queue.Properties",
+		"exits with 1 if there is nothing at path")
+
+	flags.Parse(args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if flags.NArg() != 2 {
+		exitWithUsage(flags)
+	}
+
+	node, err := loadTemplate(flags.Arg(0), &load)
+
+	failf(err)
+
+	expanded, err := yaml.Expand(node)
+
+	failf(pathError(flags.Arg(0), err))
+
+	value := yaml.Find(expanded, flags.Arg(1))
+	if value == nil {
+		failf(fmt.Errorf("%s: path %s not found", flags.Arg(0), flags.Arg(1)))
+	}
+
+	if value.Kind == yaml.ScalarNode {
+		fmt.Println(value.Value)
+		return
+	}
+
+	out, err := yaml.MarshalFromTree(&yaml.Node{Kind: yaml.DocumentNode, Children: []*yaml.Node{value}}, true, true)
+
+	failf(err)
+
+	os.Stdout.Write(out)
+}
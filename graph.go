@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+)
+
+// graphCommand prints the dependencies between the resources of a
+// template, through intrinsic functions and DependsOn.
+func graphCommand(args []string) {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	var format = flags.String("format", "dot", "Output format: dot (Graphviz), text or json")
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "graph [options] <source>",
+		"e.g. cf-plus graph stack.yml | dot -Tsvg > stack.svg")
+
+	flags.Parse(args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if flags.NArg() != 1 || (*format != "dot" && *format != "text" && *format != "json") {
+		exitWithUsage(flags)
+	}
+
+	node, err := loadTemplate(flags.Arg(0), &load)
+
+	failf(err)
+
+	graph, err := cfn.ResourceGraph(node)
+
+	failf(pathError(flags.Arg(0), err))
+
+	switch *format {
+	case "dot":
+		os.Stdout.Write(graph.DOT())
+	case "json":
+		out, err := json.MarshalIndent(graph, "", "  ")
+
+		failf(err)
+
+		fmt.Println(string(out))
+	default:
+		for _, d := range graph.Dependencies {
+			fmt.Println(d)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+)
+
+// lintCommand reports likely mistakes in templates, such as references to
+// undeclared names and declarations that are never used.
+func lintCommand(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+	var rules = flags.String("rules", "", "Comma separated rules to check. Default is every rule")
+	var list = flags.Bool("list", false, "List the rules and exit")
+	var jobs = flags.Int("j", runtime.NumCPU(), "Number of templates to lint in parallel")
+
+	flags.Usage = usage(flags, "lint [options] <source or glob>...",
+		"exits with 1 if any template has problems")
+
+	patterns := parseInterspersed(flags, args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if *list {
+		for _, rule := range cfn.LintRules {
+			fmt.Printf("%-21s %s\n", rule.Name, rule.Description)
+		}
+		return
+	}
+
+	if len(patterns) == 0 || *jobs < 1 {
+		exitWithUsage(flags)
+	}
+
+	var names []string
+	if *rules != "" {
+		for _, name := range strings.Split(*rules, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+
+	inputs, err := expandInputs(patterns, "")
+
+	failf(err)
+
+	problems := make([][]cfn.Problem, len(inputs))
+
+	errs := parallel(len(inputs), *jobs, func(i int) error {
+		node, err := loadTemplate(inputs[i].path, &load)
+		if err != nil {
+			return err
+		}
+
+		problems[i], err = cfn.Lint(node, names)
+		return pathError(inputs[i].path, err)
+	})
+
+	found := false
+	for i, in := range inputs {
+		for _, p := range problems[i] {
+			fmt.Printf("%s:%d:%d: %s [%s]\n", in.path, p.Line, p.Column, p.Message, p.Rule)
+			found = true
+		}
+	}
+
+	exitOnFailures(errs)
+
+	if found {
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// loadOptions controls how templates are read.
+type loadOptions struct {
+	maxIncludeSize int64
+	libraries      stringList
+	// limits bounds the expansion of the aliases of the templates read.
+	limits yaml.Limits
+	// strict reports keys defined twice in a mapping as errors.
+	strict bool
+}
+
+// register defines the flags that set o on flags.
+func (o *loadOptions) register(flags *flag.FlagSet) {
+	flags.Int64Var(&o.maxIncludeSize, "max-include-size", cfn.DefaultMaxIncludeSize, "Largest file in bytes that can be inlined with !File, !FileBase64 or !FileJSON")
+	flags.Var(&o.libraries, "library", "File of anchors that templates can refer to with aliases. Can be given several times")
+	flags.IntVar(&o.limits.MaxNodes, "max-nodes", yaml.DefaultLimits.MaxNodes, "Most nodes a template may expand to once its aliases are resolved. 0 for no limit")
+	flags.IntVar(&o.limits.MaxDepth, "max-depth", yaml.DefaultLimits.MaxDepth, "Deepest a template may nest once its aliases are resolved. 0 for no limit")
+	flags.Int64Var(&o.limits.MaxOutputSize, "max-output-size", yaml.DefaultLimits.MaxOutputSize, "Largest output in bytes a template may produce. 0 for no limit")
+	flags.BoolVar(&o.strict, "strict", false, "Report keys defined twice in a mapping as errors. Keys overriding those merged in with << are allowed")
+}
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// stdinPath is the source path that reads the template from stdin.
+const stdinPath = "-"
+
+// loadTemplate reads and parses the template at path, or from stdin if
+// path is stdinPath, inlining any files it includes. Files included by a
+// template read from stdin are relative to the working directory.
+func loadTemplate(path string, opts *loadOptions) (*yaml.Node, error) {
+	node, _, err := loadTemplateFiles(path, opts)
+	return node, err
+}
+
+// loadTemplateFiles is like loadTemplate but also returns the paths of the
+// library files and the files included by the template.
+func loadTemplateFiles(path string, opts *loadOptions) (*yaml.Node, []string, error) {
+	libraries, files, err := loadLibraries(opts)
+	if err != nil {
+		return nil, files, err
+	}
+
+	node, err := parseSource(path, opts.strict, libraries)
+	if err != nil {
+		return nil, files, err
+	}
+
+	node.SetFile(path)
+	node.SetLimits(opts.limits)
+
+	included, err := cfn.IncludeFiles(node, filepath.Dir(path), opts.maxIncludeSize)
+	files = append(files, included...)
+	if err != nil {
+		return nil, files, pathError(path, err)
+	}
+
+	return node, files, nil
+}
+
+// parseSource parses the template at path, or streams it from stdin if
+// path is stdinPath, letting its aliases refer to the anchors of libraries.
+func parseSource(path string, strict bool, libraries []*yaml.Node) (*yaml.Node, error) {
+	var node *yaml.Node
+	var err error
+	if path == stdinPath {
+		node, err = yaml.UnmarshalWithLibrariesFromReader(os.Stdin, strict, libraries)
+	} else {
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+		node, err = yaml.UnmarshalWithLibraries(data, strict, libraries)
+	}
+	return node, pathError(path, err)
+}
+
+// readSource reads the file at path, or stdin if path is stdinPath, for
+// commands that need the bytes of the source as well as its tree.
+func readSource(path string) ([]byte, error) {
+	if path == stdinPath {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// loadLibraries reads the library files in opts, inlining the files they
+// include, and returns them with the paths of the files read. Libraries can
+// refer to the anchors of the libraries before them.
+func loadLibraries(opts *loadOptions) ([]*yaml.Node, []string, error) {
+	var libraries []*yaml.Node
+	var files []string
+
+	for _, path := range opts.libraries {
+		files = append(files, path)
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, files, err
+		}
+
+		library, err := yaml.UnmarshalWithLibraries(data, opts.strict, libraries)
+		if err != nil {
+			return nil, files, pathError(path, err)
+		}
+		if library == nil {
+			continue
+		}
+
+		library.SetFile(path)
+
+		included, err := cfn.IncludeFiles(library, filepath.Dir(path), opts.maxIncludeSize)
+		files = append(files, included...)
+		if err != nil {
+			return nil, files, pathError(path, err)
+		}
+
+		libraries = append(libraries, library)
+	}
+
+	return libraries, files, nil
+}
+
+// pathError records path as the file of the template err occurred in:
+// positioned errors without a file take it as theirs, and other errors are
+// prefixed with it unless the template was read from stdin.
+func pathError(path string, err error) error {
+	if err == nil {
+		return err
+	}
+	switch e := err.(type) {
+	case *yaml.Error:
+		setErrorFile(e, path)
+		return e
+	case yaml.ErrorList:
+		for _, e := range e {
+			setErrorFile(e, path)
+		}
+		return e
+	}
+	if path == stdinPath {
+		return err
+	}
+	return fmt.Errorf("%s: %v", path, err)
+}
+
+func setErrorFile(e *yaml.Error, path string) {
+	if e.File == "" {
+		e.File = path
+	}
+}
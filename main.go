@@ -1,67 +1,173 @@
 package main
 
 import (
-	"github.com/ukayani/cloudformation-plus/yaml"
 	"flag"
 	"fmt"
-	"os"
 	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
 )
 
+// Exit codes shared by the commands.
+const (
+	// exitFailure is used when a command fails or finds problems.
+	exitFailure = 1
+	// exitUsage is used when a command is given invalid arguments.
+	exitUsage = 2
+	// exitDiffer is used by diff when the templates differ. Like diff(1),
+	// it then fails with exitTrouble so differences can be told apart.
+	exitDiffer  = 1
+	exitTrouble = 2
+)
 
 func failf(err error) {
+	failWith(err, exitFailure)
+}
+
+// failWith prints err and exits with code if err isn't nil.
+func failWith(err error, code int) {
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		printError(err)
+		os.Exit(code)
 	}
 }
 
-func printUsage() {
-	flag.Usage()
-	os.Exit(1)
+// printError prints err to stderr compiler-style: one error per line,
+// with the source line of each positioned error and a caret below its
+// column.
+func printError(err error) {
+	sources := make(map[string][]byte)
+	for _, err := range flattenErrors(err) {
+		e, ok := err.(*yaml.Error)
+		if !ok {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if e.File == stdinPath {
+			e.File = "<stdin>"
+		}
+		if e.Snippet == "" && e.File != "" && e.File != "<stdin>" {
+			src, ok := sources[e.File]
+			if !ok {
+				// without its source, the error is printed on its own
+				src, _ = ioutil.ReadFile(e.File)
+				sources[e.File] = src
+			}
+			e.SetSource(src)
+		}
+		fmt.Fprintln(os.Stderr, e.Verbose())
+	}
 }
 
-func main() {
-	var removeAliases = flag.Bool("resolve-aliases", false, "Resolve all aliases to their target nodes")
-	var keepStyle = flag.Bool("keep-style", false,
-		"Keep YAML style from source document. Default is to normalize (block style with quotes removed where they can be)")
-
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of: %s <source> [dest]\n", os.Args[0])
-		flag.PrintDefaults()
+// flattenErrors returns the errors held by lists of errors, in order.
+func flattenErrors(err error) []error {
+	var errs []error
+	switch l := err.(type) {
+	case errorList:
+		for _, err := range l {
+			errs = append(errs, flattenErrors(err)...)
+		}
+	case yaml.ErrorList:
+		for _, e := range l {
+			errs = append(errs, e)
+		}
+	default:
+		errs = append(errs, err)
 	}
+	return errs
+}
 
-	flag.Parse()
-
-	if len(flag.Args()) < 1 {
-		printUsage()
+// usage returns a usage function for flags that prints line, then notes on
+// their own lines, then the flags.
+func usage(flags *flag.FlagSet, line string, notes ...string) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage of: %s %s\n", os.Args[0], line)
+		for _, note := range notes {
+			fmt.Fprintf(os.Stderr, "  %s\n", note)
+		}
+		flags.PrintDefaults()
 	}
+}
 
-	path := flag.Arg(0)
-
-	data,err := ioutil.ReadFile(path)
-
-	failf(err)
+// exitWithUsage prints the usage of flags and exits.
+func exitWithUsage(flags *flag.FlagSet) {
+	flags.Usage()
+	os.Exit(exitUsage)
+}
 
-	node, err := yaml.UnmarshalToTree([]byte(data), false)
+// A command is a subcommand of cf-plus.
+type command struct {
+	run     func(args []string)
+	summary string
+}
 
-	failf(err)
+// commands holds the subcommands of cf-plus. Without a subcommand the
+// arguments are those of build with a single source and dest.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"anchor":   {anchorCommand, "rename an anchor or inline its aliases in templates and libraries"},
+		"build":    {buildCommand, "process templates into an output directory"},
+		"dedupe":   {dedupeCommand, "replace repeated subtrees with an anchor and aliases"},
+		"diff":     {diffCommand, "report the semantic differences between two templates"},
+		"explain":  {explainCommand, "show where each key of an expanded subtree came from"},
+		"fmt":      {fmtCommand, "print, check or rewrite templates in normalized form"},
+		"get":      {getCommand, "print the value at a path of an expanded template"},
+		"graph":    {graphCommand, "print the dependencies between resources"},
+		"help":     {helpCommand, "describe a command"},
+		"lint":     {lintCommand, "report likely mistakes in templates"},
+		"map":      {mapCommand, "translate an output line back to its source line"},
+		"package":  {packageCommand, "upload local artifacts and point the template at them"},
+		"params":   {paramsCommand, "generate or check a parameters file"},
+		"validate": {validateCommand, "check templates for errors without writing them"},
+		"version":  {versionCommand, "print the version of cf-plus"},
+	}
+}
 
-	out, err := yaml.MarshalFromTree(node, *removeAliases, !*keepStyle)
+// printCommands lists the commands and their summaries.
+func printCommands() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	failf(err)
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "Run %s help <command> for the options of a command.\n", os.Args[0])
+}
 
-	outputPath := ""
+// helpCommand prints the usage of a command, or lists the commands.
+func helpCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage of: %s <command> [options] [arguments]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] [source] [dest]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  without a command, source is built to dest like build\n")
+		printCommands()
+		return
+	}
 
-	if len(flag.Args()) > 1 {
-		outputPath = flag.Arg(1)
+	c, ok := commands[args[0]]
+	if !ok || args[0] == "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %s\n", args[0])
+		printCommands()
+		os.Exit(exitUsage)
 	}
+	c.run([]string{"-h"})
+}
 
-	if len(outputPath) > 0 {
-		println("writing file to " + outputPath)
-		ioutil.WriteFile(outputPath, out, 0644)
-	} else {
-		print(string(out))
+func main() {
+	if len(os.Args) > 1 {
+		if c, ok := commands[os.Args[1]]; ok {
+			c.run(os.Args[2:])
+			return
+		}
 	}
 
-}
\ No newline at end of file
+	legacyCommand(os.Args[1:])
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// packageCommand uploads the local artifacts referred to by a template and
+// writes out the template pointing at the uploaded copies.
+func packageCommand(args []string) {
+	flags := flag.NewFlagSet("package", flag.ExitOnError)
+	var uploadDir = flags.String("upload-dir", "artifacts", "Directory to store packaged artifacts in")
+	var bucket = flags.String("bucket", "", "Bucket name to write into S3 locations of packaged artifacts")
+	var baseURL = flags.String("base-url", "", "URL the upload directory is served from, used for artifact URLs such as TemplateURL")
+	var removeAliases = flags.Bool("resolve-aliases", false, "Resolve all aliases to their target nodes")
+	var keepStyle = flags.Bool("keep-style", false, "Keep YAML style from source document")
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "package [options] <source> [dest]")
+
+	flags.Parse(args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if flags.NArg() < 1 {
+		exitWithUsage(flags)
+	}
+
+	path := flags.Arg(0)
+	node, err := loadTemplate(path, &load)
+
+	failf(err)
+
+	uploader := &cfn.FileUploader{Dir: *uploadDir, Bucket: *bucket, BaseURL: *baseURL}
+
+	// nested templates are read like their parent
+	loader := func(path string) (*yaml.Node, error) {
+		return loadTemplate(path, &load)
+	}
+
+	failf(cfn.Package(node, filepath.Dir(path), uploader, loader))
+
+	out, err := yaml.MarshalFromTree(node, *removeAliases, !*keepStyle)
+
+	failf(err)
+
+	failf(writeOutput(out, flags.Arg(1)))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+)
+
+// paramsCommand generates a skeleton parameters file for a template, or
+// checks an existing parameters file against the template.
+func paramsCommand(args []string) {
+	flags := flag.NewFlagSet("params", flag.ExitOnError)
+	var format = flags.String("format", "cli", "Format of the generated parameters file: cli or codepipeline")
+	var check = flags.String("check", "", "Parameters file to validate against the template instead of generating one")
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+
+	flags.Usage = usage(flags, "params [options] <source> [dest]",
+		"with --check, exits with 1 if the parameters file doesn't suit the template")
+
+	flags.Parse(args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if flags.NArg() < 1 || (*format != "cli" && *format != "codepipeline") {
+		exitWithUsage(flags)
+	}
+
+	node, err := loadTemplate(flags.Arg(0), &load)
+
+	failf(err)
+
+	params, err := cfn.TemplateParameters(node)
+
+	failf(err)
+
+	if *check != "" {
+		data, err := ioutil.ReadFile(*check)
+
+		failf(err)
+
+		values, err := cfn.ReadParameters(data)
+
+		failf(err)
+
+		errs := cfn.ValidateParameters(params, values)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *check, err)
+		}
+		if len(errs) > 0 {
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	var out []byte
+	if *format == "codepipeline" {
+		out, err = cfn.CodePipelineParameters(params)
+	} else {
+		out, err = cfn.CLIParameters(params)
+	}
+
+	failf(err)
+
+	failf(writeOutput(out, flags.Arg(1)))
+}
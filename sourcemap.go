@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// sourceMapFile is the format of the source map written alongside an
+// output file. Lines[i] is the source of line i+1 of the output.
+type sourceMapFile struct {
+	File  string                `json:"file"`
+	Lines []yaml.SourcePosition `json:"lines"`
+}
+
+func sourceMapPath(outputPath string) string {
+	return outputPath + ".map.json"
+}
+
+// writeSourceMap writes the source map of the output file at outputPath.
+func writeSourceMap(sourceMap []yaml.SourcePosition, outputPath string) error {
+	data, err := json.MarshalIndent(sourceMapFile{File: outputPath, Lines: sourceMap}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(sourceMapPath(outputPath), append(data, '\n'), 0644)
+}
+
+// mapCommand translates a line of an output file, such as one reported by
+// CloudFormation, back to the source line it came from using the source
+// map written with --source-map.
+func mapCommand(args []string) {
+	flags := flag.NewFlagSet("map", flag.ExitOnError)
+
+	flags.Usage = usage(flags, "map <dest> <line>",
+		"dest is an output file written with --source-map")
+
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		exitWithUsage(flags)
+	}
+
+	line, err := strconv.Atoi(flags.Arg(1))
+
+	failf(err)
+
+	data, err := ioutil.ReadFile(sourceMapPath(flags.Arg(0)))
+
+	failf(err)
+
+	var sourceMap sourceMapFile
+
+	failf(json.Unmarshal(data, &sourceMap))
+
+	if line < 1 || line > len(sourceMap.Lines) {
+		failf(fmt.Errorf("%s has no line %d", flags.Arg(0), line))
+	}
+
+	position := sourceMap.Lines[line-1]
+	fmt.Printf("%s:%d\n", position.File, position.Line)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+
+	"github.com/ukayani/cloudformation-plus/cfn"
+	"github.com/ukayani/cloudformation-plus/yaml"
+)
+
+// validateCommand checks templates for errors without writing them.
+func validateCommand(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	var load loadOptions
+	load.register(flags)
+	var configOpts configOptions
+	configOpts.register(flags)
+	var parameters = flags.String("parameters", "", "Parameters file (AWS CLI or CodePipeline format) to check against each template")
+	var jobs = flags.Int("j", runtime.NumCPU(), "Number of templates to validate in parallel")
+
+	flags.Usage = usage(flags, "validate [options] <source or glob>...",
+		"checks that templates parse, their includes, aliases and merge keys resolve, their parameters",
+		"are declared correctly, their nested stacks are passed the right parameters and they are",
+		"within CloudFormation limits",
+		"exits with 1 if any template has errors")
+
+	patterns := parseInterspersed(flags, args)
+
+	_, err := configOpts.apply(flags)
+
+	failf(err)
+
+	if len(patterns) == 0 || *jobs < 1 {
+		exitWithUsage(flags)
+	}
+
+	inputs, err := expandInputs(patterns, "")
+
+	failf(err)
+
+	errs := parallel(len(inputs), *jobs, func(i int) error {
+		return validateTemplate(inputs[i].path, &load, *parameters)
+	})
+
+	exitOnFailures(errs)
+}
+
+// validateTemplate returns every error found in the template at path.
+func validateTemplate(path string, load *loadOptions, parameters string) error {
+	node, err := loadTemplate(path, load)
+	if err != nil {
+		return err
+	}
+
+	expanded, err := yaml.Expand(node)
+	if err != nil {
+		return pathError(path, err)
+	}
+
+	var errs errorList
+
+	params, err := cfn.TemplateParameters(expanded)
+	if err != nil {
+		errs = append(errs, pathError(path, err))
+	}
+
+	for _, err := range cfn.ValidateNestedStacks(node, filepath.Dir(path), load.strict) {
+		errs = append(errs, pathError(path, err))
+	}
+
+	if parameters != "" && params != nil {
+		data, err := ioutil.ReadFile(parameters)
+		if err != nil {
+			return err
+		}
+
+		values, err := cfn.ReadParameters(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", parameters, err)
+		}
+
+		for _, err := range cfn.ValidateParameters(params, values) {
+			errs = append(errs, fmt.Errorf("%s: %v", parameters, err))
+		}
+	}
+
+	out, err := yaml.MarshalFromTree(expanded, true, true)
+	if err != nil {
+		return pathError(path, err)
+	}
+
+	violations, err := cfn.CheckLimits(out, cfn.DefaultLimits)
+	if err != nil {
+		return pathError(path, err)
+	}
+	for _, v := range violations {
+		errs = append(errs, pathError(path, v))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+)
+
+// Build metadata, set when building with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// versionCommand prints the version of cf-plus and how it was built.
+func versionCommand(args []string) {
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	flags.Usage = usage(flags, "version")
+
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		exitWithUsage(flags)
+	}
+
+	fmt.Printf("cf-plus %s (commit %s, built %s with %s for %s/%s)\n",
+		version, commit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchInterval is how often watched files are checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// A watcher builds templates and builds each of them again whenever one of
+// the files read to build it changes. Files are polled for changes, as the
+// standard library has no file system notifications.
+type watcher struct {
+	opts    *buildOptions
+	workers int
+	build   func(b *builder, i int) ([]string, error)
+	// files holds the files read by the last build of each template.
+	files  [][]string
+	stamps map[string]fileStamp
+}
+
+// stampPrecision is the coarsest precision of file modification times
+// allowed for.
+const stampPrecision = 2 * time.Second
+
+// fileStamp is what is compared to tell if a file has changed.
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, modTime: info.ModTime(), size: info.Size()}
+}
+
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.exists == o.exists && s.modTime.Equal(o.modTime) && s.size == o.size
+}
+
+// newWatcher returns a watcher of n templates, each built by calling build
+// with its index, with up to workers built at a time.
+func newWatcher(opts *buildOptions, n int, workers int, build func(b *builder, i int) ([]string, error)) *watcher {
+	return &watcher{
+		opts:    opts,
+		workers: workers,
+		build:   build,
+		files:   make([][]string, n),
+		stamps:  make(map[string]fileStamp),
+	}
+}
+
+// run builds every template, then keeps building those affected by each
+// change. Errors are reported without stopping. It never returns.
+func (w *watcher) run() {
+	all := make([]int, len(w.files))
+	for i := range all {
+		all[i] = i
+	}
+	w.rebuild(all)
+
+	for {
+		time.Sleep(watchInterval)
+
+		changed := w.changed()
+		if len(changed) == 0 {
+			continue
+		}
+
+		for path := range changed {
+			fmt.Fprintf(os.Stderr, "%s changed\n", path)
+		}
+		w.rebuild(w.affected(changed))
+	}
+}
+
+// changed returns the watched files that changed since they were last
+// seen, recording their new state.
+func (w *watcher) changed() map[string]bool {
+	changed := make(map[string]bool)
+	for path, old := range w.stamps {
+		if stamp := stampOf(path); !stamp.equal(old) {
+			changed[path] = true
+			w.stamps[path] = stamp
+		}
+	}
+	return changed
+}
+
+// affected returns the templates that read any of the changed files.
+func (w *watcher) affected(changed map[string]bool) []int {
+	var indices []int
+	for i, files := range w.files {
+		for _, path := range files {
+			if changed[path] {
+				indices = append(indices, i)
+				break
+			}
+		}
+	}
+	return indices
+}
+
+// rebuild builds the templates at indices, reports their errors and
+// watches the files they read from then on.
+func (w *watcher) rebuild(indices []int) {
+	start := time.Now()
+	b := newBuilder(w.opts)
+	errs := parallel(len(indices), w.workers, func(k int) error {
+		var err error
+		w.files[indices[k]], err = w.build(b, indices[k])
+		return err
+	})
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			printError(err)
+			failed++
+		}
+	}
+
+	// files keep the state they were seen in before building, so a change
+	// made during the build is picked up by the next check. Files first
+	// read by this build were only seen once it was done: those modified
+	// since it started, give or take the precision of modification times,
+	// may have changed after being read and are recorded as unseen so that
+	// the next check builds again.
+	stamps := make(map[string]fileStamp)
+	for _, files := range w.files {
+		for _, path := range files {
+			if stamp, ok := w.stamps[path]; ok {
+				stamps[path] = stamp
+			} else if stamp := stampOf(path); stamp.modTime.Before(start.Add(-stampPrecision)) {
+				stamps[path] = stamp
+			} else {
+				stamps[path] = fileStamp{modTime: start}
+			}
+		}
+	}
+	w.stamps = stamps
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d templates failed\n", failed, len(indices))
+	}
+	fmt.Fprintf(os.Stderr, "watching %d files for changes\n", len(w.stamps))
+}
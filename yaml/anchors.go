@@ -0,0 +1,156 @@
+package yaml
+
+// location is where a node is held in the tree: its parent and its index
+// among the parent's children.
+type location struct {
+	parent *Node
+	index  int
+}
+
+// locate records the location of every node below n.
+func locate(n *Node, locations map[*Node]location) {
+	if n.Kind == AliasNode {
+		return
+	}
+	for i, c := range n.Children {
+		locations[c] = location{n, i}
+		locate(c, locations)
+	}
+}
+
+// MoveAnchorsBeforeAliases makes every anchor in the tree rooted at in come
+// before the aliases to it in document order, as YAML requires, once the
+// nodes of the tree have been reordered. Where an alias comes first, it
+// swaps places with the node it refers to, which keeps its anchor. Aliases
+// to nodes outside the tree, such as library anchors, are left alone.
+func MoveAnchorsBeforeAliases(in *Node) {
+	if in == nil {
+		return
+	}
+
+	locations := make(map[*Node]location)
+	locate(in, locations)
+
+	seen := make(map[*Node]bool)
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Anchor != "" {
+			seen[n] = true
+		}
+		if n.Kind == AliasNode {
+			return
+		}
+		for i := range n.Children {
+			c := n.Children[i]
+			if target, ok := locations[c.Alias]; ok && c.Kind == AliasNode && !seen[c.Alias] {
+				target.parent.Children[target.index] = c
+				n.Children[i] = c.Alias
+				locations[c] = target
+				locations[c.Alias] = location{n, i}
+			}
+			walk(n.Children[i])
+		}
+	}
+	walk(in)
+}
+
+// RenameAnchor renames the anchors called old in the document in, and the
+// aliases called old, to new, returning the number of nodes renamed.
+func RenameAnchor(in *Node, old, new string) int {
+	if in == nil {
+		return 0
+	}
+
+	renamed := 0
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Anchor == old {
+			n.Anchor = new
+			renamed++
+		}
+		if n.Kind == AliasNode {
+			if n.Value == old {
+				n.Value = new
+				renamed++
+			}
+			return
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(in)
+
+	if target, ok := in.Anchors[old]; ok {
+		delete(in.Anchors, old)
+		in.Anchors[new] = target
+	}
+	return renamed
+}
+
+// InlineAnchor replaces the aliases called name in the document in with a
+// copy of the node they refer to, leaving other aliases alone, and removes
+// the anchor name from the document. The copies keep the aliases of the
+// node but not its anchors. It returns the number of aliases replaced.
+func InlineAnchor(in *Node, name string) int {
+	if in == nil {
+		return 0
+	}
+
+	var aliases []*Node
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Kind == AliasNode {
+			if n.Value == name {
+				aliases = append(aliases, n)
+			}
+			return
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(in)
+
+	// copy every target before replacing any alias, so that copies are
+	// made from the source rather than from earlier copies
+	copies := make([]*Node, len(aliases))
+	for i, alias := range aliases {
+		copies[i] = copyWithoutAnchors(alias.Alias)
+	}
+	for i, alias := range aliases {
+		alias.Replace(copies[i])
+	}
+
+	var unlabel func(n *Node)
+	unlabel = func(n *Node) {
+		if n.Anchor == name {
+			n.Anchor = ""
+		}
+		if n.Kind == AliasNode {
+			return
+		}
+		for _, c := range n.Children {
+			unlabel(c)
+		}
+	}
+	unlabel(in)
+	delete(in.Anchors, name)
+
+	return len(aliases)
+}
+
+// copyWithoutAnchors returns a deep copy of the tree rooted at n without
+// its anchors. Aliases are copied as aliases.
+func copyWithoutAnchors(n *Node) *Node {
+	out := *n
+	out.Anchor = ""
+	if n.Kind == AliasNode {
+		return &out
+	}
+	out.Children = make([]*Node, len(n.Children))
+	for i, c := range n.Children {
+		out.Children[i] = copyWithoutAnchors(c)
+	}
+	return &out
+}
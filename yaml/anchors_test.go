@@ -0,0 +1,137 @@
+package yaml
+
+import "testing"
+
+func TestRenameAnchor(t *testing.T) {
+	library := parse(t, "tags: &tags [a]\n")
+
+	tests := []struct {
+		name     string
+		src      string
+		old, new string
+		renamed  int
+		want     string
+	}{
+		{
+			name: "anchor and aliases",
+			src:  "x: &x {a: 1}\ny: *x\nz:\n  <<: *x\n  b: 2\n",
+			old:  "x", new: "base",
+			renamed: 3,
+			want:    "x: &base {a: 1}\ny: *base\nz:\n  <<: *base\n  b: 2\n",
+		},
+		{
+			name: "other anchors",
+			src:  "x: &x {a: &inner 1}\ny: *x\nw: *inner\n",
+			old:  "x", new: "base",
+			renamed: 2,
+			want:    "x: &base {a: &inner 1}\ny: *base\nw: *inner\n",
+		},
+		{
+			name: "library aliases",
+			src:  "y: *tags\nz: *tags\n",
+			old:  "tags", new: "t",
+			renamed: 2,
+			want:    "y: *t\nz: *t\n",
+		},
+		{
+			name: "missing",
+			src:  "x: &x 1\n",
+			old:  "y", new: "z",
+			want: "x: &x 1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := UnmarshalWithLibraries([]byte(test.src), false, []*Node{library})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if renamed := RenameAnchor(doc, test.old, test.new); renamed != test.renamed {
+				t.Errorf("renamed %d nodes, want %d", renamed, test.renamed)
+			}
+			out, err := MarshalSource(doc, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != test.want {
+				t.Errorf("got %q, want %q", out, test.want)
+			}
+		})
+	}
+}
+
+func TestInlineAnchor(t *testing.T) {
+	library := parse(t, "tags: &tags [a]\n")
+
+	tests := []struct {
+		name    string
+		src     string
+		anchor  string
+		inlined int
+		want    string
+	}{
+		{
+			name:    "aliases and merges",
+			src:     "x: &x {a: 1}\ny: *x\nz:\n  <<: *x\n  b: 2\n",
+			anchor:  "x",
+			inlined: 2,
+			want:    "x: {a: 1}\ny: {a: 1}\nz:\n  <<: {a: 1}\n  b: 2\n",
+		},
+		{
+			// copies don't repeat the anchors inside the node
+			name:    "inner anchors",
+			src:     "x: &x {a: &inner 1}\ny: *x\nw: *inner\n",
+			anchor:  "x",
+			inlined: 1,
+			want:    "x: {a: &inner 1}\ny: {a: 1}\nw: *inner\n",
+		},
+		{
+			name:    "inner aliases",
+			src:     "o: &o [1]\nx: &x {a: *o}\ny: *x\n",
+			anchor:  "x",
+			inlined: 1,
+			want:    "o: &o [1]\nx: {a: *o}\ny: {a: *o}\n",
+		},
+		{
+			name:    "library anchor",
+			src:     "y: *tags\nz: *tags\n",
+			anchor:  "tags",
+			inlined: 2,
+			want:    "y: [a]\nz: [a]\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := UnmarshalWithLibraries([]byte(test.src), false, []*Node{library})
+			if err != nil {
+				t.Fatal(err)
+			}
+			before, err := MarshalFromTree(doc, true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if inlined := InlineAnchor(doc, test.anchor); inlined != test.inlined {
+				t.Errorf("inlined %d aliases, want %d", inlined, test.inlined)
+			}
+			out, err := MarshalSource(doc, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != test.want {
+				t.Errorf("got %q, want %q", out, test.want)
+			}
+
+			// inlining doesn't change what the document expands to
+			after, err := MarshalFromTree(doc, true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(after) != string(before) {
+				t.Errorf("expands to %q, want %q", after, before)
+			}
+		})
+	}
+}
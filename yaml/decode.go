@@ -1,6 +1,7 @@
 package yaml
 
 import (
+	"bytes"
 	"encoding"
 	"encoding/base64"
 	"fmt"
@@ -21,6 +22,7 @@ const (
 
 type Node struct {
 	Kind         int
+	file         string
 	line, column int
 	Tag          string
 	// For an Alias Node, Alias holds the resolved Alias.
@@ -31,6 +33,8 @@ type Node struct {
 	Anchors  map[string]*Node // For document, to search up aliases
 	Anchor string
 	style yaml_style_t
+	// limits, on a document, bounds the work done expanding its aliases.
+	limits *Limits
 }
 
 func (n *Node) mappingStyle() yaml_mapping_style_t {
@@ -54,6 +58,19 @@ type parser struct {
 	event    yaml_event_t
 	doc      *Node
 	doneInit bool
+	// library holds anchors defined outside the document that aliases may
+	// refer to when the document doesn't define them.
+	library map[string]*Node
+	// source is the document being parsed if it was given as bytes, and
+	// read holds the part of it read so far if it is read from a reader.
+	// They are used for the snippets of errors.
+	source []byte
+	read   *bytes.Buffer
+	// errors holds the problems found in the current document that don't
+	// stop it from being parsed.
+	errors ErrorList
+	// strict reports keys defined twice in a mapping.
+	strict bool
 }
 
 func newParser(b []byte) *parser {
@@ -65,18 +82,27 @@ func newParser(b []byte) *parser {
 		b = []byte{'\n'}
 	}
 	yaml_parser_set_input_string(&p.parser, b)
+	p.source = b
 	return &p
 }
 
 func newParserFromReader(r io.Reader) *parser {
-	p := parser{}
+	p := parser{read: new(bytes.Buffer)}
 	if !yaml_parser_initialize(&p.parser) {
 		panic("failed to initialize YAML emitter")
 	}
-	yaml_parser_set_input_reader(&p.parser, r)
+	yaml_parser_set_input_reader(&p.parser, io.TeeReader(r, p.read))
 	return &p
 }
 
+// sourceRead returns the document being parsed, as far as it has been read.
+func (p *parser) sourceRead() []byte {
+	if p.read != nil {
+		return p.read.Bytes()
+	}
+	return p.source
+}
+
 func (p *parser) init() {
 	if p.doneInit {
 		return
@@ -124,19 +150,16 @@ func (p *parser) peek() yaml_event_type_t {
 }
 
 func (p *parser) fail() {
-	var where string
-	var line int
-	if p.parser.problem_mark.line != 0 {
-		line = p.parser.problem_mark.line
-		// Scanner errors don't iterate line before returning error
-		if p.parser.error == yaml_SCANNER_ERROR {
-			line++
-		}
-	} else if p.parser.context_mark.line != 0 {
-		line = p.parser.context_mark.line
+	// marks are 0-based, and an unset problem mark is at the start of the
+	// document, where the context mark is more useful if there is one
+	var line, column int
+	mark := p.parser.problem_mark
+	if mark.line == 0 && mark.column == 0 && p.parser.context_mark.line != 0 {
+		mark = p.parser.context_mark
 	}
-	if line != 0 {
-		where = "line " + strconv.Itoa(line) + ": "
+	if len(p.parser.problem) > 0 {
+		line = mark.line + 1
+		column = mark.column + 1
 	}
 	var msg string
 	if len(p.parser.problem) > 0 {
@@ -144,7 +167,9 @@ func (p *parser) fail() {
 	} else {
 		msg = "unknown problem parsing YAML content"
 	}
-	failf("%s%s", where, msg)
+	e := &Error{Line: line, Column: column, Code: "syntax", Message: msg}
+	e.SetSource(p.sourceRead())
+	fail(e)
 }
 
 func (p *parser) anchor(n *Node, anchor []byte) {
@@ -190,6 +215,11 @@ func (p *parser) document() *Node {
 	p.expect(yaml_DOCUMENT_START_EVENT)
 	n.Children = append(n.Children, p.parse())
 	p.expect(yaml_DOCUMENT_END_EVENT)
+	if len(p.errors) > 0 {
+		errs := p.errors
+		p.errors = nil
+		fail(errs)
+	}
 	return n
 }
 
@@ -198,7 +228,12 @@ func (p *parser) alias() *Node {
 	n.Value = string(p.event.anchor)
 	n.Alias = p.doc.Anchors[n.Value]
 	if n.Alias == nil {
-		failf("unknown anchor '%s' referenced", n.Value)
+		n.Alias = p.library[n.Value]
+	}
+	if n.Alias == nil {
+		e := NewError(n, "unknown-anchor", "unknown anchor '%s' referenced", n.Value)
+		e.SetSource(p.sourceRead())
+		p.errors = append(p.errors, e)
 	}
 	p.expect(yaml_ALIAS_EVENT)
 	return n
@@ -217,6 +252,7 @@ func (p *parser) scalar() *Node {
 
 func (p *parser) sequence() *Node {
 	n := p.node(SequenceNode)
+	n.Tag = string(p.event.tag)
 	n.Anchor = string(p.event.anchor)
 	p.anchor(n, p.event.anchor)
 	p.expect(yaml_SEQUENCE_START_EVENT)
@@ -229,6 +265,7 @@ func (p *parser) sequence() *Node {
 
 func (p *parser) mapping() *Node {
 	n := p.node(MappingNode)
+	n.Tag = string(p.event.tag)
 	n.Anchor = string(p.event.anchor)
 	p.anchor(n, p.event.anchor)
 	p.expect(yaml_MAPPING_START_EVENT)
@@ -236,9 +273,38 @@ func (p *parser) mapping() *Node {
 		n.Children = append(n.Children, p.parse(), p.parse())
 	}
 	p.expect(yaml_MAPPING_END_EVENT)
+	if p.strict {
+		p.checkDuplicateKeys(n)
+	}
 	return n
 }
 
+// checkDuplicateKeys reports the scalar keys of the mapping n that are
+// defined more than once, following keys that are aliases to the scalar
+// they refer to. Merge keys are not keys of the mapping, and the keys they
+// merge in are meant to be overridden, so neither is checked.
+func (p *parser) checkDuplicateKeys(n *Node) {
+	keys := make(map[string]*Node)
+	for i := 0; i < len(n.Children); i += 2 {
+		key := n.Children[i]
+		value := key
+		for value != nil && value.Kind == AliasNode {
+			value = value.Alias
+		}
+		if value == nil || value.Kind != ScalarNode || isMerge(key) {
+			continue
+		}
+		if first, ok := keys[value.Value]; ok {
+			e := NewError(key, "duplicate-key", "key %s is already defined at line %d, column %d",
+				value.Value, first.Line(), first.Column())
+			e.SetSource(p.sourceRead())
+			p.errors = append(p.errors, e)
+			continue
+		}
+		keys[value.Value] = key
+	}
+}
+
 // ----------------------------------------------------------------------------
 // Decoder, unmarshals a Node into a provided Value.
 
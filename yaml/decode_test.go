@@ -0,0 +1,132 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    string
+		snippet string
+	}{
+		{"a: b: c\n", "1:5: mapping values are not allowed in this context [syntax]", "a: b: c"},
+		{"a: @x\n", "1:4: found character that cannot start any token [syntax]", "a: @x"},
+		{"a: 1\n\tb: 2\n", "2:1: found a tab character that violates indentation [syntax]", "\tb: 2"},
+		{"a: 1\n b: 2\n", "2:3: mapping values are not allowed in this context [syntax]", " b: 2"},
+		{"- a\nb: 1\n", "2:1: did not find expected '-' indicator [syntax]", "b: 1"},
+		{"a: 1\nb: [1, 2\nc: 3\n", "3:2: did not find expected ',' or ']' [syntax]", "c: 3"},
+		{"a: 1\nb:\n  - x\n  y: 2\n", "4:3: did not find expected '-' indicator [syntax]", "  y: 2"},
+		{"a: 'x\n", "2:1: found unexpected end of stream [syntax]", ""},
+	}
+
+	for _, test := range tests {
+		_, err := UnmarshalToTree([]byte(test.src), false)
+		e, ok := err.(*Error)
+		if !ok || e.Error() != test.want {
+			t.Errorf("UnmarshalToTree(%q) = %v, want %s", test.src, err, test.want)
+			continue
+		}
+		if e.Snippet != test.snippet {
+			t.Errorf("UnmarshalToTree(%q) snippet = %q, want %q", test.src, e.Snippet, test.snippet)
+		}
+	}
+}
+
+func TestErrorsAreCollected(t *testing.T) {
+	_, err := UnmarshalToTree([]byte("a: &x 1\nb: *y\nc: *z\n"), false)
+	l, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got %v, want a list of errors", err)
+	}
+	var got []string
+	for _, e := range l {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		"2:4: unknown anchor 'y' referenced [unknown-anchor]",
+		"3:4: unknown anchor 'z' referenced [unknown-anchor]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestErrorVerbose(t *testing.T) {
+	tests := []struct {
+		e    Error
+		want string
+	}{
+		{Error{Message: "bad"}, "bad"},
+		{Error{File: "t.yml", Message: "bad", Code: "syntax"}, "t.yml: bad [syntax]"},
+		{Error{File: "t.yml", Line: 2, Column: 3, Message: "bad", Snippet: "a: b"}, "t.yml:2:3: bad\n    a: b\n      ^"},
+		{Error{Line: 1, Column: 2, Message: "bad", Snippet: "\tb"}, "1:2: bad\n    \tb\n    \t^"},
+	}
+
+	for _, test := range tests {
+		if got := test.e.Verbose(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "block mapping",
+			src:  "a: 1\na: 2\n",
+			want: "2:1: key a is already defined at line 1, column 1 [duplicate-key]",
+		},
+		{
+			name: "flow mapping",
+			src:  "a: {x: 1, x: 2}\n",
+			want: "1:11: key x is already defined at line 1, column 5 [duplicate-key]",
+		},
+		{
+			name: "every duplicate",
+			src:  "a: 1\nb: 2\na: 3\na: 4\n",
+			want: "3:1: key a is already defined at line 1, column 1 [duplicate-key]\n" +
+				"4:1: key a is already defined at line 1, column 1 [duplicate-key]",
+		},
+		{
+			name: "alias key",
+			src:  "k: &k Name\nR:\n  Name: 1\n  *k : 2\n",
+			want: "4:3: key Name is already defined at line 3, column 3 [duplicate-key]",
+		},
+		{
+			name: "different mappings",
+			src:  "a: 1\nb: {a: 2}\n",
+		},
+		{
+			name: "merge keys",
+			src:  "<<: {a: 1}\n<<: {b: 2}\n",
+		},
+		{
+			name: "overriding a merged key",
+			src:  "x: &x {a: 1}\ny:\n  <<: *x\n  a: 2\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := UnmarshalToTree([]byte(test.src), true)
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+			} else if err == nil || err.Error() != test.want {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+
+			// duplicates are only reported in strict mode
+			if _, err := UnmarshalToTree([]byte(test.src), false); err != nil {
+				t.Errorf("got %v without strict mode", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package yaml
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A Duplicate is a subtree repeated in a document.
+type Duplicate struct {
+	// Anchor is the name suggested for the anchor of the first occurrence,
+	// or its existing anchor.
+	Anchor string
+	// Size is the number of nodes in the subtree.
+	Size int
+	// Nodes holds the occurrences of the subtree in document order.
+	Nodes []*Node
+}
+
+// subtree is the hash and size of a subtree, and whether it holds anchors.
+type subtree struct {
+	hash     [sha256.Size]byte
+	size     int
+	anchored bool
+}
+
+// FindDuplicates returns the subtrees of at least minSize nodes that are
+// repeated in the document in, largest first. Subtrees holding anchors
+// other than at their first occurrence are left out, since replacing them
+// would remove the anchors, as are the occurrences inside larger
+// duplicates, which go when those are replaced.
+func FindDuplicates(in *Node, minSize int) []*Duplicate {
+	if in == nil {
+		return nil
+	}
+
+	subtrees := make(map[*Node]subtree)
+	keys := make(map[*Node]string)
+	var order []*Node
+	var hash func(n *Node, key string) subtree
+	hash = func(n *Node, key string) subtree {
+		h := sha256.New()
+		// plain and quoted scalars with the same value can resolve to
+		// different types, so only equally plain scalars are equal
+		plain := n.scalarStyle() == yaml_PLAIN_SCALAR_STYLE || n.scalarStyle() == yaml_ANY_SCALAR_STYLE
+		fmt.Fprintf(h, "%d\x00%s\x00%q\x00%t\x00", n.Kind, n.Tag, n.Value, plain)
+		s := subtree{size: 1, anchored: n.Anchor != ""}
+		order = append(order, n)
+		keys[n] = key
+		if n.Kind != AliasNode {
+			for i, c := range n.Children {
+				childKey := key
+				if n.Kind == MappingNode && i%2 == 1 {
+					childKey = n.Children[i-1].Value
+				}
+				cs := hash(c, childKey)
+				h.Write(cs.hash[:])
+				s.size += cs.size
+				s.anchored = s.anchored || cs.anchored
+			}
+		}
+		copy(s.hash[:], h.Sum(nil))
+		subtrees[n] = s
+		return s
+	}
+	hash(in, "")
+
+	// group the candidates by hash in document order, leaving out the
+	// document, its root and mapping keys
+	groups := make(map[[sha256.Size]byte][]*Node)
+	var hashes [][sha256.Size]byte
+	isKey := make(map[*Node]bool)
+	for _, n := range order {
+		if n.Kind == MappingNode {
+			for i := 0; i < len(n.Children); i += 2 {
+				isKey[n.Children[i]] = true
+			}
+		}
+	}
+	for _, n := range order {
+		s := subtrees[n]
+		if n.Kind == DocumentNode || n.Kind == AliasNode || isKey[n] || s.size < minSize {
+			continue
+		}
+		if in.Kind == DocumentNode && len(in.Children) > 0 && n == in.Children[0] {
+			continue
+		}
+		if len(groups[s.hash]) == 0 {
+			hashes = append(hashes, s.hash)
+		}
+		groups[s.hash] = append(groups[s.hash], n)
+	}
+
+	sort.SliceStable(hashes, func(i, j int) bool {
+		return subtrees[groups[hashes[i]][0]].size > subtrees[groups[hashes[j]][0]].size
+	})
+
+	names := make(map[string]bool)
+	if in.Anchors != nil {
+		for name := range in.Anchors {
+			names[name] = true
+		}
+	}
+
+	removed := make(map[*Node]bool)
+	var duplicates []*Duplicate
+	for _, h := range hashes {
+		var nodes []*Node
+		for _, n := range groups[h] {
+			if removed[n] {
+				continue
+			}
+			// only the first occurrence, which is kept, may hold anchors
+			if len(nodes) > 0 && subtrees[n].anchored {
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+		if len(nodes) < 2 {
+			continue
+		}
+
+		d := &Duplicate{Anchor: nodes[0].Anchor, Size: subtrees[nodes[0]].size, Nodes: nodes}
+		if d.Anchor == "" {
+			d.Anchor = uniqueName(anchorName(keys[nodes[0]]), names)
+		}
+		names[d.Anchor] = true
+
+		for _, n := range nodes[1:] {
+			markRemoved(n, removed)
+		}
+		duplicates = append(duplicates, d)
+	}
+	return duplicates
+}
+
+func markRemoved(n *Node, removed map[*Node]bool) {
+	removed[n] = true
+	if n.Kind == AliasNode {
+		return
+	}
+	for _, c := range n.Children {
+		markRemoved(c, removed)
+	}
+}
+
+// anchorName suggests an anchor name for a node held under key, such as
+// tags for a node under Tags.
+func anchorName(key string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() > 0
+			continue
+		}
+		if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		} else if upper {
+			r = unicode.ToUpper(r)
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "shared"
+	}
+	return b.String()
+}
+
+// uniqueName returns name, or name followed by the lowest number from 2
+// that makes it unused.
+func uniqueName(name string, used map[string]bool) string {
+	if !used[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		if n := fmt.Sprintf("%s%d", name, i); !used[n] {
+			return n
+		}
+	}
+}
+
+// ExtractDuplicates rewrites the document in so that the first occurrence
+// of each duplicate is labeled with its anchor and the others are aliases
+// to it.
+func ExtractDuplicates(in *Node, duplicates []*Duplicate) {
+	locations := make(map[*Node]location)
+	locate(in, locations)
+
+	for _, d := range duplicates {
+		first := d.Nodes[0]
+		first.Anchor = d.Anchor
+		if in.Anchors != nil {
+			in.Anchors[d.Anchor] = first
+		}
+		for _, n := range d.Nodes[1:] {
+			alias := &Node{Kind: AliasNode, file: n.file, line: n.line, column: n.column, Value: d.Anchor, Alias: first}
+			l := locations[n]
+			l.parent.Children[l.index] = alias
+			locations[alias] = l
+		}
+	}
+}
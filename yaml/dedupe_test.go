@@ -0,0 +1,86 @@
+package yaml
+
+import "testing"
+
+func TestExtractDuplicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		minSize int
+		want    string
+	}{
+		{
+			name:    "repeated mapping",
+			src:     "A: {Props: {X: 1, Y: 2}}\nB: {Props: {X: 1, Y: 2}}\nC: {Props: {X: 1, Y: 2}}\n",
+			minSize: 3,
+			want:    "A: &a {Props: {X: 1, Y: 2}}\nB: *a\nC: *a\n",
+		},
+		{
+			name:    "repeated list",
+			src:     "A:\n  Tags: [{Key: a, Value: b}]\nB:\n  Tags: [{Key: a, Value: b}]\n",
+			minSize: 3,
+			want:    "A: &a\n  Tags: [{Key: a, Value: b}]\nB: *a\n",
+		},
+		{
+			name:    "existing anchor",
+			src:     "A: &keep {X: 1, Y: 2}\nB: {X: 1, Y: 2}\n",
+			minSize: 3,
+			want:    "A: &keep {X: 1, Y: 2}\nB: *keep\n",
+		},
+		{
+			// 'true' is a string and true a boolean
+			name:    "quoted scalars",
+			src:     "A: {X: 1, Y: 'true'}\nB: {X: 1, Y: true}\n",
+			minSize: 3,
+			want:    "A: {X: 1, Y: 'true'}\nB: {X: 1, Y: true}\n",
+		},
+		{
+			name:    "too small",
+			src:     "A: {X: 1}\nB: {X: 1}\n",
+			minSize: 4,
+			want:    "A: {X: 1}\nB: {X: 1}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			ExtractDuplicates(doc, FindDuplicates(doc, test.minSize))
+
+			out, err := MarshalSource(doc, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != test.want {
+				t.Errorf("got %q, want %q", out, test.want)
+			}
+
+			// the rewritten document expands to the original
+			want, err := MarshalFromTree(parse(t, test.src), true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := MarshalFromTree(parse(t, string(out)), true, false); err != nil || string(got) != string(want) {
+				t.Errorf("rewritten document expands to %q (%v), want %q", got, err, want)
+			}
+		})
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	// occurrences inside a larger duplicate go with it
+	doc := parse(t, "A: {P: {X: 1, Y: 2}}\nB: {P: {X: 1, Y: 2}}\nC: {X: 1, Y: 2}\n")
+	duplicates := FindDuplicates(doc, 3)
+	if len(duplicates) != 2 {
+		t.Fatalf("got %d duplicates, want 2", len(duplicates))
+	}
+
+	largest := duplicates[0]
+	if largest.Size != 7 || len(largest.Nodes) != 2 || largest.Nodes[0].Line() != 1 || largest.Nodes[1].Line() != 2 {
+		t.Errorf("got size %d with %d occurrences, want A and B of size 7", largest.Size, len(largest.Nodes))
+	}
+	inner := duplicates[1]
+	if inner.Size != 5 || len(inner.Nodes) != 2 || inner.Nodes[1].Line() != 3 {
+		t.Errorf("got size %d with %d occurrences, want A.P and C of size 5", inner.Size, len(inner.Nodes))
+	}
+}
@@ -0,0 +1,99 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// An Error is a problem found at a position of a YAML document.
+type Error struct {
+	// File is the name of the file the problem is in, if known.
+	File string
+	// Line and Column are the 1-based position of the problem, or 0 if
+	// unknown.
+	Line, Column int
+	// Code identifies the kind of problem, such as syntax or unknown-anchor.
+	Code    string
+	Message string
+	// Snippet is the source line the problem is on, if known.
+	Snippet string
+}
+
+// NewError returns an Error with code at the position of n.
+func NewError(n *Node, code string, format string, args ...interface{}) *Error {
+	e := &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		e.File = n.File()
+		e.Line = n.Line()
+		e.Column = n.Column()
+	}
+	return e
+}
+
+// Error returns the problem on one line, in the file:line:column form
+// used by compilers.
+func (e *Error) Error() string {
+	var where []string
+	if e.File != "" {
+		where = append(where, e.File)
+	}
+	if e.Line > 0 {
+		where = append(where, fmt.Sprint(e.Line), fmt.Sprint(e.Column))
+	}
+
+	msg := e.Message
+	if len(where) > 0 {
+		msg = strings.Join(where, ":") + ": " + msg
+	}
+	if e.Code != "" {
+		msg += " [" + e.Code + "]"
+	}
+	return msg
+}
+
+// Verbose returns the problem followed, if known, by the source line it is
+// on and a caret below its column.
+func (e *Error) Verbose() string {
+	if e.Snippet == "" {
+		return e.Error()
+	}
+
+	// Keep the tabs of the source line so the caret lines up below it.
+	indent := []rune(e.Snippet)
+	if e.Column-1 < len(indent) {
+		indent = indent[:e.Column-1]
+	}
+	for i, r := range indent {
+		if r != '\t' {
+			indent[i] = ' '
+		}
+	}
+
+	return fmt.Sprintf("%s\n    %s\n    %s^", e.Error(), e.Snippet, string(indent))
+}
+
+// SetSource sets the snippet of e to its line of src, the contents of the
+// file it is in.
+func (e *Error) SetSource(src []byte) {
+	if e.Line < 1 {
+		return
+	}
+	lines := bytes.Split(src, []byte("\n"))
+	if e.Line > len(lines) {
+		return
+	}
+	e.Snippet = strings.TrimRight(string(lines[e.Line-1]), "\r")
+}
+
+// An ErrorList holds the problems found in a document, reported together
+// one per line.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	lines := make([]string, len(l))
+	for i, e := range l {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
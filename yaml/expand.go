@@ -0,0 +1,317 @@
+package yaml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expand returns a copy of the tree rooted at in with every alias replaced
+// by a copy of the node it refers to and every merge key (<<) resolved into
+// the mapping that holds it. The source tree is left untouched. Nodes keep
+// the position of the source node they were copied from.
+func Expand(in *Node) (out *Node, err error) {
+	defer handleErr(&err)
+	if in == nil {
+		return nil, nil
+	}
+	out = newExpander(limitsOf(in)).expandTree(in)
+	return
+}
+
+// An Origin records where a key of an expanded mapping came from.
+type Origin struct {
+	// Line is the line of the key in the source document.
+	Line int
+	// Merged is whether the key was merged in with <<, from the mapping
+	// labeled Anchor, if any.
+	Merged bool
+	Anchor string
+	// Overrides holds the merged keys this key took precedence over.
+	Overrides []*Origin
+	// MergedWith holds the merged keys whose mapping values were merged
+	// into the value of this key.
+	MergedWith []*Origin
+}
+
+// ExpandWithOrigins is like Expand but also returns the origin of each key
+// in the expanded tree that was merged in or that overrides merged keys.
+// Keys without an entry are defined in place.
+func ExpandWithOrigins(in *Node) (out *Node, origins map[*Node]*Origin, err error) {
+	defer handleErr(&err)
+	e := newExpander(limitsOf(in))
+	e.origins = make(map[*Node]*Origin)
+	if in != nil {
+		out = e.expandTree(in)
+	}
+	origins = e.origins
+	return
+}
+
+// ExpandWithSources is like Expand but also returns, for each node of the
+// expanded tree, the node of the source tree it was copied from, so that
+// changes found on the expanded tree can be made to the source. Nodes
+// copied from a mapping merged in through an alias map to the node labeled
+// by the anchor, which every other alias to it shares.
+func ExpandWithSources(in *Node) (out *Node, sources map[*Node]*Node, err error) {
+	defer handleErr(&err)
+	e := newExpander(limitsOf(in))
+	e.sources = make(map[*Node]*Node)
+	if in != nil {
+		out = e.expandTree(in)
+	}
+	sources = e.sources
+	return
+}
+
+// expander copies a tree, resolving aliases and merge keys.
+type expander struct {
+	// origins, when not nil, records the origin of merged and overriding keys.
+	origins map[*Node]*Origin
+	// sources, when not nil, records the source node of each expanded node.
+	sources map[*Node]*Node
+	// errors holds the problems found so far, which don't stop the rest of
+	// the tree from being expanded.
+	errors ErrorList
+	limits Limits
+	// nodes counts the nodes expanded so far, and depth is the nesting of
+	// the node being expanded.
+	nodes, depth int
+	// size is the least output, in bytes, the nodes expanded so far produce.
+	size int64
+	// path holds the anchored nodes and the aliases being expanded,
+	// outermost first, to find aliases that refer to a node containing them.
+	path []*Node
+	// cycles holds the aliases already reported as part of a cycle.
+	cycles map[*Node]bool
+}
+
+func newExpander(limits Limits) *expander {
+	return &expander{limits: limits}
+}
+
+// expandTree expands in, failing with every problem found if there are any.
+func (e *expander) expandTree(in *Node) *Node {
+	out := e.expand(in)
+	if len(e.errors) > 0 {
+		fail(e.errors)
+	}
+	return out
+}
+
+func (e *expander) expand(in *Node) *Node {
+	if in.Kind == AliasNode {
+		if !e.follow(in) {
+			out := *in
+			return &out
+		}
+		defer e.leave()
+		return e.expand(in.Alias)
+	}
+
+	if in.Anchor != "" {
+		e.path = append(e.path, in)
+		defer e.leave()
+	}
+
+	e.nodes++
+	if e.limits.MaxNodes > 0 && e.nodes > e.limits.MaxNodes {
+		e.failLimit(in, "expanding aliases produces more than %d nodes", e.limits.MaxNodes)
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+	if e.limits.MaxDepth > 0 && e.depth > e.limits.MaxDepth {
+		e.failLimit(in, "expanding aliases nests deeper than %d levels", e.limits.MaxDepth)
+	}
+	e.size += minOutputSize(in)
+	if e.limits.MaxOutputSize > 0 && e.size > e.limits.MaxOutputSize {
+		e.failLimit(in, "expanding aliases produces more than %d bytes of output", e.limits.MaxOutputSize)
+	}
+
+	out := *in
+	out.Anchor = ""
+	out.Children = nil
+	if in.Kind == DocumentNode {
+		out.Anchors = make(map[string]*Node)
+	}
+	if e.sources != nil {
+		e.sources[&out] = in
+	}
+
+	var merges []*Node
+
+	for i := 0; i < len(in.Children); i++ {
+		c := in.Children[i]
+		if in.Kind == MappingNode && i%2 == 0 && isMerge(c) {
+			merges = append(merges, in.Children[i+1])
+			i++
+			continue
+		}
+		out.Children = append(out.Children, e.expand(c))
+	}
+
+	// keys of the mapping itself take precedence over merged ones, so
+	// merges are applied once the mapping's own keys are in place
+	for _, m := range merges {
+		e.merge(&out, m, "")
+	}
+
+	return &out
+}
+
+// follow adds alias to the path being expanded, unless the node it refers
+// to is being expanded already, in which case the cycle is reported and
+// false is returned.
+func (e *expander) follow(alias *Node) bool {
+	for i, n := range e.path {
+		if n != alias.Alias {
+			continue
+		}
+		if !e.cycles[alias] {
+			if e.cycles == nil {
+				e.cycles = make(map[*Node]bool)
+			}
+			e.cycles[alias] = true
+			cycle := append(append([]*Node(nil), e.path[i:]...), alias)
+			e.errors = append(e.errors, NewError(alias, "alias-cycle",
+				"alias *%s refers to a node that contains it: %s", alias.Value, describePath(cycle)))
+		}
+		return false
+	}
+	e.path = append(e.path, alias)
+	return true
+}
+
+// leave removes the innermost node of the path being expanded.
+func (e *expander) leave() {
+	e.path = e.path[:len(e.path)-1]
+}
+
+// describePath describes anchored nodes and aliases by their names and
+// lines, e.g. &base (line 2) -> *base (line 5).
+func describePath(path []*Node) string {
+	parts := make([]string, len(path))
+	for i, n := range path {
+		if n.Kind == AliasNode {
+			parts[i] = fmt.Sprintf("*%s (line %d)", n.Value, n.Line())
+		} else {
+			parts[i] = fmt.Sprintf("&%s (line %d)", n.Anchor, n.Line())
+		}
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// failLimit fails for exceeding a limit while expanding n, at the
+// innermost alias being expanded if there is one.
+func (e *expander) failLimit(n *Node, format string, args ...interface{}) {
+	for i := len(e.path) - 1; i >= 0; i-- {
+		if alias := e.path[i]; alias.Kind == AliasNode {
+			format += " at alias *" + alias.Value
+			n = alias
+			break
+		}
+	}
+	failLimit(n, format, args...)
+}
+
+// merge merges the source node b into the expanded mapping a. anchor is
+// the name b was referred to by, if any.
+func (e *expander) merge(a *Node, b *Node, anchor string) {
+	switch b.Kind {
+	case AliasNode:
+		if e.follow(b) {
+			e.merge(a, b.Alias, b.Value)
+			e.leave()
+		}
+	case MappingNode:
+		if anchor == "" {
+			anchor = b.Anchor
+		}
+		e.mergeMapping(a, e.expand(b), anchor)
+	case SequenceNode:
+		for _, c := range b.Children {
+			if c.Kind != MappingNode && (c.Kind != AliasNode || c.Alias.Kind != MappingNode) {
+				e.errors = append(e.errors, NewError(c, "invalid-merge", "merge key (<<) expects mappings in its sequence"))
+				continue
+			}
+			e.merge(a, c, "")
+		}
+	default:
+		e.errors = append(e.errors, NewError(b, "invalid-merge", "merge key (<<) expects a mapping or a sequence of mappings"))
+	}
+}
+
+func (e *expander) mergeMapping(a *Node, b *Node, anchor string) {
+	var keyMap = make(map[string]int)
+	var la = len(a.Children)
+	for i := 0; i < la; i += 2 {
+		key := a.Children[i]
+		if key.Kind == ScalarNode {
+			keyMap[key.Value] = i
+		}
+	}
+
+	var lb = len(b.Children)
+	for i := 0; i < lb; i += 2 {
+		key := b.Children[i]
+		value := b.Children[i+1]
+
+		// get the corresponding key in the source node A
+		index, keyExistsInSource := keyMap[key.Value]
+
+		// if it is a scalar key and it doesn't exist in the source node, just include it
+		if key.Kind != ScalarNode || !keyExistsInSource {
+			a.Children = append(a.Children, key, value)
+			e.mergedKey(key, value, anchor)
+			continue
+		}
+
+		sourceKey, sourceChild := a.Children[index], a.Children[index+1]
+
+		// deep merge
+		if sourceChild.Kind == MappingNode && value.Kind == MappingNode {
+			e.mergeMapping(sourceChild, value, anchor)
+			e.overridingKey(sourceKey, key, anchor, true)
+		} else {
+			e.overridingKey(sourceKey, key, anchor, false)
+		}
+	}
+}
+
+// mergedKey records that key, and the keys within its value, were merged
+// in from anchor.
+func (e *expander) mergedKey(key *Node, value *Node, anchor string) {
+	if e.origins == nil {
+		return
+	}
+	// keys merged through several levels keep their innermost origin
+	if _, ok := e.origins[key]; !ok {
+		e.origins[key] = &Origin{Line: key.Line(), Merged: true, Anchor: anchor}
+	}
+	if value.Kind == MappingNode {
+		for i := 0; i+1 < len(value.Children); i += 2 {
+			e.mergedKey(value.Children[i], value.Children[i+1], anchor)
+		}
+	}
+}
+
+// overridingKey records that key took precedence over the merged key from
+// anchor, or had the merged key's value merged into its own if deep is set.
+func (e *expander) overridingKey(key *Node, merged *Node, anchor string, deep bool) {
+	if e.origins == nil {
+		return
+	}
+	origin, ok := e.origins[key]
+	if !ok {
+		origin = &Origin{Line: key.Line()}
+		e.origins[key] = origin
+	}
+	from := e.origins[merged]
+	if from == nil || !from.Merged {
+		from = &Origin{Line: merged.Line(), Merged: true, Anchor: anchor}
+	}
+	if deep {
+		origin.MergedWith = append(origin.MergedWith, from)
+	} else {
+		origin.Overrides = append(origin.Overrides, from)
+	}
+}
@@ -0,0 +1,162 @@
+package yaml
+
+import "testing"
+
+// marshal emits doc keeping its style, failing the test if it can't.
+func marshal(t *testing.T, doc *Node) string {
+	t.Helper()
+	out, err := MarshalFromTree(doc, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "alias",
+			src:  "x: &x {a: 1}\ny: *x\n",
+			want: "x: {a: 1}\ny: {a: 1}\n",
+		},
+		{
+			name: "merge",
+			src:  "x: &x {a: 1, b: 2}\ny:\n  <<: *x\n  c: 3\n",
+			want: "x: {a: 1, b: 2}\ny:\n  c: 3\n  a: 1\n  b: 2\n",
+		},
+		{
+			name: "own keys take precedence",
+			src:  "x: &x {a: 1, b: 2}\ny:\n  <<: *x\n  b: 3\n",
+			want: "x: {a: 1, b: 2}\ny:\n  b: 3\n  a: 1\n",
+		},
+		{
+			name: "sequence of merges",
+			src:  "x: &x {a: 1}\ny: &y {b: 2}\nz:\n  <<: [*x, *y]\n",
+			want: "x: {a: 1}\ny: {b: 2}\nz:\n  a: 1\n  b: 2\n",
+		},
+		{
+			name: "deep merge",
+			src:  "x: &x\n  P: {a: 1}\ny:\n  <<: *x\n  P: {b: 2}\n",
+			want: "x:\n  P: {a: 1}\ny:\n  P: {b: 2, a: 1}\n",
+		},
+		{
+			// merging into a copy keeps the merged keys out of other
+			// aliases to the same anchor
+			name: "deep merge doesn't leak",
+			src:  "base: &base\n  P: {a: 1}\nx:\n  <<: [*base, {P: {b: 2}}]\ny: *base\n",
+			want: "base:\n  P: {a: 1}\nx:\n  P: {a: 1, b: 2}\ny:\n  P: {a: 1}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			before := marshal(t, doc)
+
+			out, err := Expand(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := marshal(t, out); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if after := marshal(t, doc); after != before {
+				t.Errorf("source changed from %q to %q", before, after)
+			}
+		})
+	}
+}
+
+func TestExpandInvalidMerge(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"y: {<<: 1}\n", "1:9: merge key (<<) expects a mapping or a sequence of mappings [invalid-merge]"},
+		{"y:\n  <<: [{a: 1}, 2]\n", "2:16: merge key (<<) expects mappings in its sequence [invalid-merge]"},
+	}
+
+	for _, test := range tests {
+		_, err := Expand(parse(t, test.src))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Expand(%q) = %v, want %s", test.src, err, test.want)
+		}
+	}
+}
+
+func TestExpandWithSources(t *testing.T) {
+	doc := parse(t, "x: &x {a: 1}\ny:\n  <<: *x\n  b: 2\n")
+	out, sources, err := ExpandWithSources(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the merged value maps to the node labeled by the anchor
+	a := Find(out, "y.a")
+	if a == nil || sources[a] != Find(doc, "x.a") {
+		t.Errorf("source of y.a is %v, want x.a", sources[a])
+	}
+	b := Find(out, "y.b")
+	if b == nil || sources[b] != Find(doc, "y.b") {
+		t.Errorf("source of y.b is %v, want y.b", sources[b])
+	}
+}
+
+func TestExpandCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "alias in its anchor",
+			src:  "x: &x\n  a: *x\n",
+			want: "2:6: alias *x refers to a node that contains it: &x (line 1) -> *x (line 2) [alias-cycle]",
+		},
+		{
+			name: "self merge",
+			src:  "x: &x\n  <<: *x\n  a: 1\n",
+			want: "2:7: alias *x refers to a node that contains it: &x (line 1) -> *x (line 2) [alias-cycle]",
+		},
+		{
+			name: "sequence",
+			src:  "x: &x [1, *x]\n",
+			want: "1:11: alias *x refers to a node that contains it: &x (line 1) -> *x (line 1) [alias-cycle]",
+		},
+		{
+			name: "through another anchor",
+			src:  "a: &a\n  b: &b\n    c: *a\n",
+			want: "3:8: alias *a refers to a node that contains it: &a (line 1) -> &b (line 2) -> *a (line 3) [alias-cycle]",
+		},
+		{
+			name: "every alias reported",
+			src:  "a: &a {k: 1}\nb: &b\n  <<: *a\n  c: *b\n  d: *b\n",
+			want: "4:6: alias *b refers to a node that contains it: &b (line 2) -> *b (line 4) [alias-cycle]\n" +
+				"5:6: alias *b refers to a node that contains it: &b (line 2) -> *b (line 5) [alias-cycle]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Expand(parse(t, test.src))
+			if err == nil || err.Error() != test.want {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandRepeatedAliases(t *testing.T) {
+	// aliases used many times, or nested in each other, aren't cycles
+	src := "a: &a {k: 1}\nb: &b [*a, *a]\nc: [*b, *a, *b]\n"
+	out, err := Expand(parse(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a: {k: 1}\nb: [{k: 1}, {k: 1}]\nc: [[{k: 1}, {k: 1}], {k: 1}, [{k: 1}, {k: 1}]]\n"
+	if got := marshal(t, out); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
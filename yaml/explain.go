@@ -0,0 +1,95 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Explain returns the subtree of in at path, such as Resources.Broker2,
+// fully expanded and annotated with the origin of each mapping key: the
+// line it is defined on, the anchor it was merged in from, or the merged
+// keys it overrides. Path segments are mapping keys or sequence indexes
+// separated by dots; an empty path explains the whole document.
+func Explain(in *Node, path string) (out []byte, err error) {
+	defer handleErr(&err)
+
+	expanded, origins, err := ExpandWithOrigins(in)
+	if err != nil {
+		return nil, err
+	}
+
+	n := Find(expanded, path)
+	if n == nil {
+		return nil, fmt.Errorf("path %s not found", path)
+	}
+
+	doc := &Node{Kind: DocumentNode, Children: []*Node{n}}
+	emitted, err := MarshalFromTree(doc, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// the emitted document has the same structure as the expanded one, so
+	// walking both together finds the emitted line of each key
+	parsed, err := UnmarshalToTree(emitted, false)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make(map[int]string)
+	annotate(n, parsed.Children[0], origins, annotations)
+
+	lines := strings.SplitAfter(string(emitted), "\n")
+	var buf bytes.Buffer
+	for i, line := range lines {
+		if comment, ok := annotations[i]; ok {
+			indent := len(line) - len(strings.TrimLeft(line, " -"))
+			buf.WriteString(strings.Repeat(" ", indent) + "# " + comment + "\n")
+		}
+		buf.WriteString(line)
+	}
+	return buf.Bytes(), nil
+}
+
+// annotate records, by 0-based emitted line, the description of the
+// origin of each key in the expanded tree n, walking the emitted tree
+// emitted alongside it.
+func annotate(n *Node, emitted *Node, origins map[*Node]*Origin, annotations map[int]string) {
+	for i, c := range n.Children {
+		if i >= len(emitted.Children) {
+			return
+		}
+		if n.Kind == MappingNode && i%2 == 0 {
+			annotations[emitted.Children[i].line] = describeOrigin(c, origins[c])
+		}
+		annotate(c, emitted.Children[i], origins, annotations)
+	}
+}
+
+func describeOrigin(key *Node, origin *Origin) string {
+	if origin == nil {
+		return fmt.Sprintf("line %d", key.Line())
+	}
+
+	var parts []string
+	if origin.Merged {
+		parts = append(parts, "merged from "+describeSource(origin))
+	} else {
+		parts = append(parts, fmt.Sprintf("line %d", origin.Line))
+	}
+	for _, o := range origin.Overrides {
+		parts = append(parts, "overrides "+describeSource(o))
+	}
+	for _, o := range origin.MergedWith {
+		parts = append(parts, "merged with "+describeSource(o))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeSource(origin *Origin) string {
+	if origin.Anchor == "" {
+		return fmt.Sprintf("line %d", origin.Line)
+	}
+	return fmt.Sprintf("&%s at line %d", origin.Anchor, origin.Line)
+}
@@ -0,0 +1,43 @@
+package yaml
+
+import "testing"
+
+func TestExplain(t *testing.T) {
+	src := "base: &base\n  Type: Q\n  Props: {A: 1, B: 2}\nR:\n  <<: *base\n  Props: {B: 3}\n  Name: x\nL: [x, {c: 2}]\n"
+
+	tests := []struct {
+		path, want string
+	}{
+		{
+			path: "R",
+			want: "# line 6, merged with &base at line 3\nProps:\n" +
+				"  # line 6, overrides &base at line 3\n  B: 3\n" +
+				"  # merged from &base at line 3\n  A: 1\n" +
+				"# line 7\nName: x\n" +
+				"# merged from &base at line 2\nType: Q\n",
+		},
+		{
+			path: "R.Props",
+			want: "# line 6, overrides &base at line 3\nB: 3\n# merged from &base at line 3\nA: 1\n",
+		},
+		{
+			path: "L.1",
+			want: "# line 8\nc: 2\n",
+		},
+	}
+
+	for _, test := range tests {
+		out, err := Explain(parse(t, src), test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if string(out) != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.path, out, test.want)
+		}
+	}
+
+	if _, err := Explain(parse(t, src), "R.Missing"); err == nil || err.Error() != "path R.Missing not found" {
+		t.Errorf("got %v, want path R.Missing not found", err)
+	}
+}
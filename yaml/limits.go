@@ -0,0 +1,84 @@
+package yaml
+
+import (
+	"fmt"
+	"io"
+)
+
+// Limits bounds the work done expanding aliases, so that a small document
+// whose aliases refer to each other many times over ("billion laughs")
+// fails instead of exhausting CPU and memory. A zero field means no limit.
+type Limits struct {
+	// MaxNodes is the largest number of nodes a tree may expand to.
+	MaxNodes int
+	// MaxDepth is the deepest an expanded tree may nest.
+	MaxDepth int
+	// MaxOutputSize is the largest document, in bytes, that may be
+	// marshalled from a tree. It is also checked while expanding, against
+	// an estimate of the output from the values and items expanded, so
+	// that expanding stops before a huge tree is built in memory.
+	MaxOutputSize int64
+}
+
+// DefaultLimits are the limits of documents that have none set with
+// SetLimits. They are far above what any CloudFormation template needs.
+var DefaultLimits = Limits{
+	MaxNodes:      1000000,
+	MaxDepth:      1000,
+	MaxOutputSize: 100 << 20,
+}
+
+// SetLimits sets the limits applied when expanding and marshalling the
+// document n, and the trees expanded from it.
+func (n *Node) SetLimits(l Limits) {
+	if n != nil {
+		n.limits = &l
+	}
+}
+
+// limitsOf returns the limits of the document n.
+func limitsOf(n *Node) Limits {
+	if n != nil && n.limits != nil {
+		return *n.limits
+	}
+	return DefaultLimits
+}
+
+// failLimit fails with an error at n for exceeding a limit.
+func failLimit(n *Node, format string, args ...interface{}) {
+	fail(NewError(n, "limit", format, args...))
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// minOutputSize estimates the bytes n is emitted in, not counting its
+// children: the value of a scalar, and a byte for the indicator or
+// separator of each item of a sequence and each key of a mapping.
+func minOutputSize(n *Node) int64 {
+	switch n.Kind {
+	case ScalarNode:
+		return int64(len(n.Value))
+	case SequenceNode:
+		return int64(len(n.Children))
+	case MappingNode:
+		return int64(len(n.Children) / 2)
+	}
+	return 0
+}
+
+// checkOutputSize fails if size exceeds the output size limit.
+func checkOutputSize(l Limits, size int64) {
+	if l.MaxOutputSize > 0 && size > l.MaxOutputSize {
+		fail(&Error{Code: "limit", Message: fmt.Sprintf("output exceeds the limit of %d bytes", l.MaxOutputSize)})
+	}
+}
@@ -0,0 +1,98 @@
+package yaml
+
+import "testing"
+
+// aliasBomb expands to more than ten thousand nodes from four lines.
+const aliasBomb = "a: &a [x, x, x, x, x, x, x, x, x, x]\n" +
+	"b: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a, *a]\n" +
+	"c: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b, *b]\n" +
+	"d: [*c, *c, *c, *c, *c, *c, *c, *c, *c, *c]\n"
+
+func TestExpandLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		limits Limits
+		want   string
+	}{
+		{
+			name:   "nodes",
+			src:    aliasBomb,
+			limits: Limits{MaxNodes: 500},
+			want:   "2:20: expanding aliases produces more than 500 nodes at alias *a [limit]",
+		},
+		{
+			name:   "depth",
+			src:    "a: &a [[[x]]]\nb: [[[*a]]]\n",
+			limits: Limits{MaxDepth: 6},
+			want:   "2:7: expanding aliases nests deeper than 6 levels at alias *a [limit]",
+		},
+		{
+			// the output size is checked while expanding, before the
+			// whole tree is built
+			name:   "output size",
+			src:    aliasBomb,
+			limits: Limits{MaxOutputSize: 1000},
+			want:   "2:28: expanding aliases produces more than 1000 bytes of output at alias *a [limit]",
+		},
+		{
+			name:   "within limits",
+			src:    aliasBomb,
+			limits: Limits{MaxNodes: 20000, MaxDepth: 10, MaxOutputSize: 40000},
+		},
+		{
+			name: "no limits",
+			src:  aliasBomb,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parse(t, test.src)
+			doc.SetLimits(test.limits)
+
+			_, err := Expand(doc)
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.want {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+
+			// resolving aliases while marshalling applies the same limits
+			if _, err := MarshalFromTree(doc, true, false); err == nil || err.Error() != test.want {
+				t.Errorf("marshalling got %v, want %s", err, test.want)
+			}
+			// keeping aliases doesn't expand them
+			if _, err := MarshalFromTree(doc, false, false); err != nil {
+				t.Errorf("marshalling with aliases got %v", err)
+			}
+		})
+	}
+}
+
+func TestLimitsArePerDocument(t *testing.T) {
+	limited := parse(t, aliasBomb)
+	limited.SetLimits(Limits{MaxNodes: 10})
+	unlimited := parse(t, aliasBomb)
+
+	if _, err := Expand(limited); err == nil {
+		t.Error("got no error expanding the limited document")
+	}
+	if _, err := Expand(unlimited); err != nil {
+		t.Errorf("got %v expanding a document with the default limits", err)
+	}
+}
+
+func TestMarshalOutputSize(t *testing.T) {
+	doc := parse(t, "a: xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx\n")
+	doc.SetLimits(Limits{MaxOutputSize: 20})
+
+	want := "output exceeds the limit of 20 bytes [limit]"
+	if _, err := MarshalFromTree(doc, false, false); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
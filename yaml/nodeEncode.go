@@ -12,6 +12,19 @@ type nodeEncoder struct {
 	doneInit bool
 	removeAliases bool
 	normalize bool
+	// anchored holds the anchored nodes of the document being emitted.
+	// Aliases to other nodes, such as library anchors, are emitted as a
+	// copy of the node they refer to.
+	anchored map[*Node]bool
+	// keepAliases emits every alias as an alias, even those to nodes outside
+	// the document.
+	keepAliases bool
+	// expander expands the aliases of the document being emitted, counting
+	// them all against the limits.
+	expander *expander
+	limits   Limits
+	// writer counts the bytes written when emitting to a writer.
+	writer *countingWriter
 }
 
 func newNodeEncoder() *nodeEncoder {
@@ -23,9 +36,9 @@ func newNodeEncoder() *nodeEncoder {
 }
 
 func newNodeEncoderWithWriter(w io.Writer) *nodeEncoder {
-	e := &nodeEncoder{}
+	e := &nodeEncoder{writer: &countingWriter{w: w}}
 	yaml_emitter_initialize(&e.emitter)
-	yaml_emitter_set_output_writer(&e.emitter, w)
+	yaml_emitter_set_output_writer(&e.emitter, e.writer)
 	yaml_emitter_set_unicode(&e.emitter, true)
 	return e
 }
@@ -52,6 +65,11 @@ func (e *nodeEncoder) destroy() {
 func (e *nodeEncoder) emit() {
 	// This will internally delete the e.event Value.
 	e.must(yaml_emitter_emit(&e.emitter, &e.event))
+	if e.writer != nil {
+		checkOutputSize(e.limits, e.writer.n)
+	} else {
+		checkOutputSize(e.limits, int64(len(e.out)))
+	}
 }
 
 func (e *nodeEncoder) must(ok bool) {
@@ -68,7 +86,18 @@ func (e *nodeEncoder) marshalDoc(in *Node, removeAliases bool, normalize bool) {
 	e.init()
 	e.removeAliases = removeAliases
 	e.normalize = normalize
+	// an empty source has no document to emit
+	if in == nil {
+		return
+	}
 	e.must(in.Kind == DocumentNode)
+	e.limits = limitsOf(in)
+	e.expander = newExpander(e.limits)
+	if removeAliases {
+		in = e.expander.expandTree(in)
+	}
+	e.anchored = make(map[*Node]bool)
+	anchoredNodes(in, e.anchored)
 	yaml_document_start_event_initialize(&e.event, nil, nil, true)
 	e.emit()
 	for _,c := range in.Children {
@@ -109,97 +138,14 @@ func (e *nodeEncoder) emitMapping(in *Node) {
 	yaml_mapping_start_event_initialize(&e.event, []byte(anchor), []byte(in.Tag), implicit, style)
 	e.emit()
 
-	// first pass through keys of this map to see if any are special merge keys
-	// gather all values and resolve them and then merge them according to the spec with the current node
-	// then process the current node as is, with all merge keys resolved
-
-
-	var l = len(in.Children)
-
-	if e.removeAliases {
-		for i := 0; i < l; i +=2 {
-			key := in.Children[i]
-			if isMerge(key) {
-				e.merge(in, in.Children[i + 1])
-			}
-		}
-		// update length since it most likely changed due to merge
-		l = len(in.Children)
-	}
-
-	for i := 0; i < l; i += 2 {
-		key := in.Children[i]
-		value := in.Children[i+1]
-		if !e.removeAliases || !isMerge(key) {
-			e.marshal(key)
-			e.marshal(value)
-		}
+	for _, c := range in.Children {
+		e.marshal(c)
 	}
 
 	yaml_mapping_end_event_initialize(&e.event)
 	e.emit()
 }
 
-func (e *nodeEncoder) merge(a *Node, b *Node) {
-	switch b.Kind {
-	case MappingNode:
-		e.mergeMapping(a, b)
-	case SequenceNode:
-		e.mergeSequence(a, b)
-	case AliasNode:
-		e.merge(a, b.Alias)
-	default:
-		failf("Illegal value type (%d) for merge key", b.Kind)
-	}
-}
-
-func (e *nodeEncoder) mergeMapping(a *Node, b *Node) {
-	var keyMap = make(map[string]*Node)
-	var la = len(a.Children)
-	for i := 0; i < la; i += 2 {
-		key := a.Children[i]
-		value := a.Children[i + 1]
-		if key.Kind == ScalarNode {
-			keyMap[key.Value] = value
-		}
-	}
-
-	var lb = len(b.Children)
-	for i := 0; i < lb; i += 2 {
-		key := b.Children[i]
-		value := b.Children[i + 1]
-
-		// get the corresponding key in the source node A
-		sourceChild, keyExistsInSource := keyMap[key.Value]
-
-		// if it is a scalar key and it doesn't exist in the source node, just include it
-		if key.Kind != ScalarNode || !keyExistsInSource {
-			a.Children = append(a.Children, key, value)
-		}
-
-		// deep merge
-		if keyExistsInSource && sourceChild.Kind == MappingNode && value.Kind == MappingNode {
-			e.mergeMapping(sourceChild, value)
-		}
-	}
-}
-
-func (e *nodeEncoder) mergeSequence(a *Node, b *Node) {
-	for _, c := range b.Children {
-		switch c.Kind {
-		case AliasNode:
-			if c.Alias.Kind != MappingNode {
-				failf("Illegal value type (%d) in sequence for merge key", c.Kind)
-			}
-			e.mergeMapping(a, c.Alias)
-		case MappingNode:
-			e.mergeMapping(a, c)
-		default:
-			failf("Illegal value type (%d) in sequence for merge key", c.Kind)
-		}
-	}
-}
-
 func (e *nodeEncoder) emitSequence(in *Node) {
 	implicit := in.Tag == ""
 
@@ -227,11 +173,10 @@ func (e *nodeEncoder) emitSequence(in *Node) {
 }
 
 func (e *nodeEncoder) emitAlias(in *Node) {
-	if e.removeAliases {
-		e.marshal(in.Alias)
+	if !e.keepAliases && !e.anchored[in.Alias] {
+		e.marshal(e.expander.expandTree(in.Alias))
 		return
 	}
-
 	e.must(yaml_alias_event_initialize(&e.event, []byte(in.Value)))
 	e.emit()
 }
@@ -245,19 +190,48 @@ func (e *nodeEncoder) emitScalar(in *Node) {
 		anchor = in.Anchor
 	}
 
-	style := yaml_ANY_SCALAR_STYLE
+	style := in.scalarStyle()
 	implicit := tag == ""
 
-	if !implicit {
-		style = yaml_SINGLE_QUOTED_SCALAR_STYLE
-	}
-
-	if !e.normalize {
-		style = in.scalarStyle()
+	if e.normalize && !isBlock(style) {
+		style = yaml_ANY_SCALAR_STYLE
+		if !implicit {
+			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
+		}
 	}
 
 	value := in.Value
 
+	// keep quotes where removing them would change the resolved type, e.g. '' or 'true'.
+	// Values built outside the parser are strings, so are treated as quoted.
+	if implicit && style == yaml_ANY_SCALAR_STYLE && (isQuoted(in.scalarStyle()) || in.scalarStyle() == yaml_ANY_SCALAR_STYLE) {
+		if rtag, _ := resolve("", value); rtag != yaml_STR_TAG {
+			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
+		}
+	}
+
 	e.must(yaml_scalar_event_initialize(&e.event, []byte(anchor), []byte(tag), []byte(value), implicit, implicit, style))
 	e.emit()
 }
+
+// anchoredNodes adds the nodes of the tree rooted at n that have an
+// anchor to anchored, without following aliases.
+func anchoredNodes(n *Node, anchored map[*Node]bool) {
+	if n.Anchor != "" {
+		anchored[n] = true
+	}
+	if n.Kind == AliasNode {
+		return
+	}
+	for _, c := range n.Children {
+		anchoredNodes(c, anchored)
+	}
+}
+
+func isQuoted(style yaml_scalar_style_t) bool {
+	return style == yaml_SINGLE_QUOTED_SCALAR_STYLE || style == yaml_DOUBLE_QUOTED_SCALAR_STYLE
+}
+
+func isBlock(style yaml_scalar_style_t) bool {
+	return style == yaml_LITERAL_SCALAR_STYLE || style == yaml_FOLDED_SCALAR_STYLE
+}
@@ -0,0 +1,63 @@
+package yaml
+
+import "testing"
+
+// parse parses src, failing the test if it isn't valid YAML.
+func parse(t *testing.T, src string) *Node {
+	t.Helper()
+	doc, err := UnmarshalToTree([]byte(src), false)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	return doc
+}
+
+func TestMarshalNormalized(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"plain", "a: x\nb: 1\n", "a: x\nb: 1\n"},
+		{"unneeded quotes", "a: 'x'\nb: \"z\"\n", "a: x\nb: z\n"},
+		{"empty string", "a: ''\n", "a: ''\n"},
+		{"boolean string", "a: 'true'\nb: \"no\"\n", "a: 'true'\nb: 'no'\n"},
+		{"number string", "a: '1'\nb: '1.5'\n", "a: '1'\nb: '1.5'\n"},
+		{"null string", "a: 'null'\nb: '~'\n", "a: 'null'\nb: '~'\n"},
+		{"null", "a: ~\nb:\n", "a: ~\nb: \n"},
+		{"literal block", "a: |\n  x\n  y\n", "a: |\n  x\n  y\n"},
+		{"flow collections", "a: {x: [1, 2]}\n", "a:\n  x:\n  - 1\n  - 2\n"},
+		{"tagged", "a: !Ref X\n", "a: !Ref 'X'\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := MarshalFromTree(parse(t, test.src), false, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != test.want {
+				t.Errorf("got %q, want %q", out, test.want)
+			}
+		})
+	}
+}
+
+func TestMarshalBuiltScalars(t *testing.T) {
+	doc := &Node{Kind: DocumentNode, Children: []*Node{NewMapping(
+		NewScalar("a", ""), NewScalar("true", ""),
+		NewScalar("b", ""), NewScalar("", ""),
+		NewScalar("c", ""), NewScalar("10", ""),
+		NewScalar("d", ""), NewScalar("x", ""),
+		NewScalar("e", ""), NewLiteralScalar("x\ny\n"),
+	)}}
+	want := "a: 'true'\nb: ''\nc: '10'\nd: x\ne: |\n  x\n  y\n"
+
+	for _, normalize := range []bool{false, true} {
+		out, err := MarshalFromTree(doc, false, normalize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Errorf("normalize %v: got %q, want %q", normalize, out, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package yaml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Find returns the node at path in the tree rooted at in, following
+// aliases, or nil if there is none. Path segments are mapping keys or
+// sequence indexes separated by dots, such as Resources.Broker2; an empty
+// path finds the root node of the document.
+func Find(in *Node, path string) *Node {
+	n := resolveAlias(in)
+	if n != nil && n.Kind == DocumentNode {
+		if len(n.Children) == 0 {
+			return nil
+		}
+		n = resolveAlias(n.Children[0])
+	}
+	if path == "" {
+		return n
+	}
+	for _, segment := range strings.Split(path, ".") {
+		if n == nil {
+			return nil
+		}
+		n = resolveAlias(child(n, segment))
+	}
+	return n
+}
+
+// child returns the value of key in a mapping, or the element at the
+// index key in a sequence.
+func child(n *Node, key string) *Node {
+	switch n.Kind {
+	case MappingNode:
+		for i := 0; i+1 < len(n.Children); i += 2 {
+			k := resolveAlias(n.Children[i])
+			if k.Kind == ScalarNode && k.Value == key {
+				return n.Children[i+1]
+			}
+		}
+	case SequenceNode:
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 && i < len(n.Children) {
+			return n.Children[i]
+		}
+	}
+	return nil
+}
+
+func resolveAlias(n *Node) *Node {
+	for n != nil && n.Kind == AliasNode {
+		n = n.Alias
+	}
+	return n
+}
@@ -0,0 +1,73 @@
+package yaml
+
+// A SourcePosition is the file and 1-based line a node was parsed from.
+type SourcePosition struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// MarshalWithSourceMap is like MarshalFromTree but also returns, for each
+// line of out, the position of the source node that produced it. Aliases,
+// merge keys and nodes replaced in the tree keep the position of the node
+// they were copied from. Lines that don't start a node, such as the
+// continuation of a multi-line scalar, map to the node they belong to.
+func MarshalWithSourceMap(in *Node, removeAliases bool, normalize bool) (out []byte, sourceMap []SourcePosition, err error) {
+	defer handleErr(&err)
+
+	if removeAliases && in != nil {
+		in = newExpander(limitsOf(in)).expandTree(in)
+	}
+
+	out, err = MarshalFromTree(in, false, normalize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the emitted document has the same structure as the tree it was
+	// emitted from, so walking both together finds the source of each
+	// emitted node
+	emitted, err := UnmarshalToTree(out, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := 0
+	for _, c := range out {
+		if c == '\n' {
+			lines++
+		}
+	}
+
+	sourceMap = make([]SourcePosition, lines)
+	set := make([]bool, lines)
+
+	var walk func(n *Node, e *Node, parent SourcePosition)
+	walk = func(n *Node, e *Node, parent SourcePosition) {
+		position := parent
+		if n.file != "" || n.line != 0 {
+			position = SourcePosition{File: n.file, Line: n.Line()}
+		}
+		// nodes are visited outermost first, so the most specific node
+		// starting on a line decides its source
+		if e.line < lines {
+			sourceMap[e.line] = position
+			set[e.line] = true
+		}
+		for i, c := range n.Children {
+			if i < len(e.Children) {
+				walk(c, e.Children[i], position)
+			}
+		}
+	}
+	if emitted != nil {
+		walk(in, emitted, SourcePosition{File: in.file})
+	}
+
+	for i := range sourceMap {
+		if !set[i] && i > 0 {
+			sourceMap[i] = sourceMap[i-1]
+		}
+	}
+
+	return out, sourceMap, nil
+}
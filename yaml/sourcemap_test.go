@@ -0,0 +1,54 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarshalWithSourceMap(t *testing.T) {
+	doc := parse(t, "base: &base\n  a: 1\n  b: |\n    x\n    y\nR:\n  <<: *base\n  c: 2\n")
+	doc.SetFile("t.yml")
+
+	out, sourceMap, err := MarshalWithSourceMap(doc, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "base:\n  a: 1\n  b: |\n    x\n    y\nR:\n  c: 2\n  a: 1\n  b: |\n    x\n    y\n"
+	if string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+
+	// merged keys map to the lines they are merged from, and the lines of
+	// a block scalar to the line it starts on
+	var lines []int
+	for _, p := range sourceMap {
+		if p.File != "t.yml" {
+			t.Errorf("got file %q, want t.yml", p.File)
+		}
+		lines = append(lines, p.Line)
+	}
+	wantLines := []int{1, 2, 3, 3, 3, 6, 8, 2, 3, 3, 3}
+	if !reflect.DeepEqual(lines, wantLines) {
+		t.Errorf("got lines %v, want %v", lines, wantLines)
+	}
+}
+
+func TestMarshalWithSourceMapReplacedNodes(t *testing.T) {
+	doc := parse(t, "a: 1\nb: 2\n")
+	doc.SetFile("t.yml")
+	Find(doc, "b").Replace(NewMapping(NewScalar("c", ""), NewScalar("3", "")))
+
+	out, sourceMap, err := MarshalWithSourceMap(doc, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "a: 1\nb:\n  c: '3'\n" {
+		t.Errorf("got %q", out)
+	}
+	// nodes built in place of a source node take its position
+	want := []SourcePosition{{"t.yml", 1}, {"t.yml", 2}, {"t.yml", 2}}
+	if !reflect.DeepEqual(sourceMap, want) {
+		t.Errorf("got %v, want %v", sourceMap, want)
+	}
+}
@@ -1,13 +1,57 @@
 package yaml
 
+import "io"
+
+// UnmarshalToTree parses the YAML document in into a Node tree. In strict
+// mode, keys defined twice in a mapping are reported as errors.
 func UnmarshalToTree(in []byte, strict bool) (node *Node, err error) {
 	defer handleErr(&err)
 	p := newParser(in)
 	defer p.destroy()
+	p.strict = strict
 	node = p.parse()
 	return
 }
 
+// UnmarshalWithLibraries is like UnmarshalToTree but lets aliases in the
+// document refer to anchors defined in the library documents, where the
+// document doesn't define them itself. Later libraries take precedence.
+// When marshalled, aliases to library anchors are replaced by a copy of
+// the node they refer to.
+func UnmarshalWithLibraries(in []byte, strict bool, libraries []*Node) (node *Node, err error) {
+	defer handleErr(&err)
+	p := newParser(in)
+	defer p.destroy()
+	p.strict = strict
+	p.setLibraries(libraries)
+	node = p.parse()
+	return
+}
+
+// UnmarshalWithLibrariesFromReader is like UnmarshalWithLibraries but
+// reads the document from r.
+func UnmarshalWithLibrariesFromReader(r io.Reader, strict bool, libraries []*Node) (node *Node, err error) {
+	defer handleErr(&err)
+	p := newParserFromReader(r)
+	defer p.destroy()
+	p.strict = strict
+	p.setLibraries(libraries)
+	node = p.parse()
+	return
+}
+
+func (p *parser) setLibraries(libraries []*Node) {
+	p.library = make(map[string]*Node)
+	for _, l := range libraries {
+		if l == nil {
+			continue
+		}
+		for name, n := range l.Anchors {
+			p.library[name] = n
+		}
+	}
+}
+
 func MarshalFromTree(in *Node, removeAliases bool, normalize bool) (out []byte, err error) {
 	defer handleErr(&err)
 	e := newNodeEncoder()
@@ -17,3 +61,89 @@ func MarshalFromTree(in *Node, removeAliases bool, normalize bool) (out []byte,
 	out = e.out
 	return
 }
+
+// MarshalSource is like MarshalFromTree but emits the document as a
+// source: every alias is kept as an alias, including those to anchors
+// outside the document such as library anchors. Its style is kept unless
+// normalize is set.
+func MarshalSource(in *Node, normalize bool) (out []byte, err error) {
+	defer handleErr(&err)
+	e := newNodeEncoder()
+	defer e.destroy()
+	e.keepAliases = true
+	e.marshalDoc(in, false, normalize)
+	e.finish()
+	out = e.out
+	return
+}
+
+// MarshalTreeToWriter is like MarshalFromTree but writes the document to w
+// as it is emitted.
+func MarshalTreeToWriter(w io.Writer, in *Node, removeAliases bool, normalize bool) (err error) {
+	defer handleErr(&err)
+	e := newNodeEncoderWithWriter(w)
+	defer e.destroy()
+	e.marshalDoc(in, removeAliases, normalize)
+	e.finish()
+	return
+}
+
+// NewScalar returns a scalar node holding value. An empty tag lets the
+// value be resolved implicitly.
+func NewScalar(value string, tag string) *Node {
+	return &Node{Kind: ScalarNode, Value: value, Tag: tag, implicit: tag == ""}
+}
+
+// NewLiteralScalar returns a scalar node holding value that is emitted as
+// a literal block scalar (|) where possible.
+func NewLiteralScalar(value string) *Node {
+	return &Node{Kind: ScalarNode, Value: value, implicit: true, style: yaml_style_t(yaml_LITERAL_SCALAR_STYLE)}
+}
+
+// NewMapping returns a mapping node from alternating keys and values.
+func NewMapping(children ...*Node) *Node {
+	return &Node{Kind: MappingNode, Children: children}
+}
+
+// NewSequence returns a sequence node holding children.
+func NewSequence(children ...*Node) *Node {
+	return &Node{Kind: SequenceNode, Children: children}
+}
+
+// Line returns the 1-based line of the node in its source document.
+func (n *Node) Line() int {
+	return n.line + 1
+}
+
+// Column returns the 1-based column of the node in its source document.
+func (n *Node) Column() int {
+	return n.column + 1
+}
+
+// File returns the name of the file the node was parsed from, if known.
+func (n *Node) File() string {
+	return n.file
+}
+
+// SetFile records file as the source of n and every node below it that
+// has no source file yet.
+func (n *Node) SetFile(file string) {
+	if n == nil || n.file != "" {
+		return
+	}
+	n.file = file
+	if n.Kind == AliasNode {
+		return
+	}
+	for _, c := range n.Children {
+		c.SetFile(file)
+	}
+}
+
+// Replace overwrites n in place with the contents of with, keeping the
+// anchor and position of n. Aliases referring to n see the new contents.
+func (n *Node) Replace(with *Node) {
+	anchor, file, line, column := n.Anchor, n.file, n.line, n.column
+	*n = *with
+	n.Anchor, n.file, n.line, n.column = anchor, file, line, column
+}
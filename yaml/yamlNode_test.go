@@ -0,0 +1,105 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalWithLibraries(t *testing.T) {
+	libraries := []*Node{
+		parse(t, "tags: &tags [{Key: a, Value: b}]\nprops: &props {X: 1}\n"),
+		parse(t, "props: &props {X: 2}\n"),
+	}
+
+	tests := []struct {
+		name, src, want, source string
+	}{
+		{
+			// later libraries take precedence
+			name:   "library anchors",
+			src:    "A: *tags\nB:\n  <<: *props\n  Y: 2\n",
+			want:   "A: [{Key: a, Value: b}]\nB:\n  <<: {X: 2}\n  Y: 2\n",
+			source: "A: *tags\nB:\n  <<: *props\n  Y: 2\n",
+		},
+		{
+			name:   "own anchors first",
+			src:    "props: &props {X: 3}\nA: *props\n",
+			want:   "props: &props {X: 3}\nA: *props\n",
+			source: "props: &props {X: 3}\nA: *props\n",
+		},
+	}
+
+	parsers := map[string]func(src string) (*Node, error){
+		"bytes": func(src string) (*Node, error) {
+			return UnmarshalWithLibraries([]byte(src), false, libraries)
+		},
+		"reader": func(src string) (*Node, error) {
+			return UnmarshalWithLibrariesFromReader(strings.NewReader(src), false, libraries)
+		},
+	}
+
+	for _, test := range tests {
+		for name, unmarshal := range parsers {
+			doc, err := unmarshal(test.src)
+			if err != nil {
+				t.Errorf("%s from %s: %v", test.name, name, err)
+				continue
+			}
+			if got := marshal(t, doc); got != test.want {
+				t.Errorf("%s from %s: got %q, want %q", test.name, name, got, test.want)
+			}
+			source, err := MarshalSource(doc, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(source) != test.source {
+				t.Errorf("%s from %s: got source %q, want %q", test.name, name, source, test.source)
+			}
+		}
+	}
+}
+
+func TestMarshalSourceNormalized(t *testing.T) {
+	library := parse(t, "tags: &tags [{Key: a, Value: b}]\n")
+	doc, err := UnmarshalWithLibraries([]byte("A: {T: *tags, N: 'x'}\n"), false, []*Node{library})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the alias to the library stays an alias in normalized form
+	out, err := MarshalSource(doc, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "A:\n  T: *tags\n  N: x\n"; string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestUnmarshalFromReaderErrors(t *testing.T) {
+	tests := []struct {
+		src, want, snippet string
+	}{
+		{"a: 1\nb: [1, 2\nc: 3\n", "3:2: did not find expected ',' or ']' [syntax]", "c: 3"},
+		{"a: 1\nb: *missing\n", "2:4: unknown anchor 'missing' referenced [unknown-anchor]", "b: *missing"},
+	}
+
+	for _, test := range tests {
+		_, err := UnmarshalWithLibrariesFromReader(strings.NewReader(test.src), false, nil)
+		var e *Error
+		switch err := err.(type) {
+		case *Error:
+			e = err
+		case ErrorList:
+			e = err[0]
+		}
+		if e == nil || e.Error() != test.want {
+			t.Errorf("got %v, want %s", err, test.want)
+			continue
+		}
+		// the snippet comes from the source read, which can't be read again
+		if e.Snippet != test.snippet {
+			t.Errorf("got snippet %q, want %q", e.Snippet, test.snippet)
+		}
+	}
+}